@@ -1,30 +1,357 @@
 package config
 
 import (
+	"auth-service/utils"
+	"crypto/sha256"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type Config struct {
 	AccessTTL     time.Duration
 	RefreshTTL    time.Duration
-	AccessSecret  []byte
 	RefreshSecret []byte
+
+	// RememberMeRefreshTTL replaces RefreshTTL for logins that asked to be
+	// remembered. No session outlives SessionMaxLifetime, however often it is
+	// refreshed. MaxSessionsPerUser of 0 means no limit.
+	RememberMeRefreshTTL time.Duration
+	SessionMaxLifetime   time.Duration
+	MaxSessionsPerUser   int
+
+	RefreshTokenGCInterval  time.Duration
+	RefreshTokenGCBatchSize int
+
+	SigningKeysDir      string
+	SigningKeys         []SigningKey
+	KeyRotationInterval time.Duration
+	KeyReloadInterval   time.Duration
+
+	LoginMaxUserFailures int
+	LoginMaxIPFailures   int
+	LoginFailureWindow   time.Duration
+	LoginLockoutBase     time.Duration
+	LoginLockoutMax      time.Duration
+
+	// TrustedProxies are the services, as identified by serviceauth, whose
+	// x-forwarded-for and x-forwarded-user-agent headers are believed. "*"
+	// trusts every caller and is only meant for development.
+	TrustedProxies []string
+	// TokenRevokers are the services allowed to revoke a user's access
+	// tokens on their own behalf, without forwarding a user's access token.
+	// "*" trusts every caller and is only meant for development.
+	TokenRevokers []string
+
+	TotpIssuer string
+	// TotpEncryptionKey is the AES-256 key TOTP secrets are sealed with
+	// before they are stored, derived from TOTP_ENCRYPTION_KEY.
+	TotpEncryptionKey []byte
+	LoginChallengeTTL time.Duration
+
+	// Each username and client IP may request PasswordResetMaxRequests and
+	// PasswordResetMaxIPRequests resets per PasswordResetWindow.
+	PasswordResetTTL           time.Duration
+	PasswordResetMaxRequests   int
+	PasswordResetMaxIPRequests int
+	PasswordResetWindow        time.Duration
+
+	OIDCProviders []OIDCProvider
+	OIDCStateTTL  time.Duration
+
+	// OAuthIssuer is the public base URL of the authorization server
+	// endpoints. OAuthScopeRoles maps each scope a client can request onto
+	// the role it unlocks in access tokens.
+	OAuthIssuer     string
+	OAuthCodeTTL    time.Duration
+	OAuthScopeRoles map[string]string
+
+	// APIKeyAccessTTL is the lifetime of access tokens exchanged for an API
+	// key. MaxAPIKeysPerUser of 0 means no limit.
+	APIKeyAccessTTL   time.Duration
+	MaxAPIKeysPerUser int
+
+	ImpersonationTTL time.Duration
 }
 
 func LoadConfig() (*Config, error) {
-	accessSecret := []byte(os.Getenv("ACCESS_TOKEN_SECRET"))
 	refreshSecret := []byte(os.Getenv("REFRESH_TOKEN_SECRET"))
 
-	if len(accessSecret) == 0 || len(refreshSecret) == 0 {
-		return nil, fmt.Errorf("ACCESS_TOKEN_SECRET and REFRESH_TOKEN_SECRET must be set")
+	if len(refreshSecret) == 0 {
+		return nil, fmt.Errorf("REFRESH_TOKEN_SECRET must be set")
+	}
+
+	totpEncryptionSecret := os.Getenv("TOTP_ENCRYPTION_KEY")
+	if totpEncryptionSecret == "" {
+		return nil, fmt.Errorf("TOTP_ENCRYPTION_KEY must be set")
+	}
+	totpEncryptionKey := sha256.Sum256([]byte(totpEncryptionSecret))
+
+	accessTTL, err := durationFromEnv("ACCESS_TOKEN_TTL", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshTTL, err := durationFromEnv("REFRESH_TOKEN_TTL", 7*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	rememberMeRefreshTTL, err := durationFromEnv("REMEMBER_ME_REFRESH_TTL", 30*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionMaxLifetime, err := durationFromEnv("SESSION_MAX_LIFETIME", 90*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	if accessTTL <= 0 || refreshTTL <= 0 || rememberMeRefreshTTL <= 0 || sessionMaxLifetime <= 0 {
+		return nil, fmt.Errorf("token TTLs and SESSION_MAX_LIFETIME must be positive")
+	}
+	if refreshTTL < accessTTL {
+		return nil, fmt.Errorf("REFRESH_TOKEN_TTL must not be shorter than ACCESS_TOKEN_TTL")
+	}
+
+	maxSessionsPerUser, err := intFromEnv("MAX_SESSIONS_PER_USER", 10)
+	if err != nil {
+		return nil, err
+	}
+	if maxSessionsPerUser < 0 {
+		return nil, fmt.Errorf("MAX_SESSIONS_PER_USER must not be negative")
+	}
+
+	keyRotationInterval, err := durationFromEnv("JWT_KEY_ROTATION_INTERVAL", 30*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	keyReloadInterval, err := durationFromEnv("JWT_KEYS_RELOAD_INTERVAL", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	loginMaxUserFailures, err := intFromEnv("LOGIN_MAX_USER_FAILURES", 5)
+	if err != nil {
+		return nil, err
+	}
+
+	loginMaxIPFailures, err := intFromEnv("LOGIN_MAX_IP_FAILURES", 20)
+	if err != nil {
+		return nil, err
+	}
+
+	loginFailureWindow, err := durationFromEnv("LOGIN_FAILURE_WINDOW", 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	loginLockoutBase, err := durationFromEnv("LOGIN_LOCKOUT_BASE", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	loginLockoutMax, err := durationFromEnv("LOGIN_LOCKOUT_MAX", time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	loginChallengeTTL, err := durationFromEnv("LOGIN_CHALLENGE_TTL", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshTokenGCInterval, err := durationFromEnv("REFRESH_TOKEN_GC_INTERVAL", time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshTokenGCBatchSize, err := intFromEnv("REFRESH_TOKEN_GC_BATCH_SIZE", 1000)
+	if err != nil {
+		return nil, err
+	}
+	if refreshTokenGCBatchSize < 1 {
+		return nil, fmt.Errorf("REFRESH_TOKEN_GC_BATCH_SIZE must be positive")
+	}
+
+	passwordResetTTL, err := durationFromEnv("PASSWORD_RESET_TTL", 30*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	passwordResetMaxRequests, err := intFromEnv("PASSWORD_RESET_MAX_REQUESTS", 3)
+	if err != nil {
+		return nil, err
+	}
+
+	passwordResetMaxIPRequests, err := intFromEnv("PASSWORD_RESET_MAX_IP_REQUESTS", 20)
+	if err != nil {
+		return nil, err
+	}
+
+	passwordResetWindow, err := durationFromEnv("PASSWORD_RESET_WINDOW", time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	oidcProviders, err := loadOIDCProviders()
+	if err != nil {
+		return nil, err
+	}
+
+	oidcStateTTL, err := durationFromEnv("OIDC_STATE_TTL", 10*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	oauthCodeTTL, err := durationFromEnv("OAUTH_CODE_TTL", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	oauthScopeRoles, err := scopeRolesFromEnv("OAUTH_SCOPE_ROLES")
+	if err != nil {
+		return nil, err
+	}
+
+	apiKeyAccessTTL, err := durationFromEnv("API_KEY_ACCESS_TOKEN_TTL", 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if apiKeyAccessTTL <= 0 {
+		return nil, fmt.Errorf("API_KEY_ACCESS_TOKEN_TTL must be positive")
+	}
+
+	maxAPIKeysPerUser, err := intFromEnv("MAX_API_KEYS_PER_USER", 25)
+	if err != nil {
+		return nil, err
+	}
+	if maxAPIKeysPerUser < 0 {
+		return nil, fmt.Errorf("MAX_API_KEYS_PER_USER must not be negative")
+	}
+
+	impersonationTTL, err := durationFromEnv("IMPERSONATION_TTL", 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if impersonationTTL <= 0 {
+		return nil, fmt.Errorf("IMPERSONATION_TTL must be positive")
+	}
+
+	signingKeysDir := utils.GetEnv("JWT_SIGNING_KEYS_DIR", "keys")
+	signingKeys, err := LoadSigningKeys(signingKeysDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(signingKeys) == 0 && keyRotationInterval == 0 {
+		return nil, fmt.Errorf("no signing keys found in %s and JWT_KEY_ROTATION_INTERVAL is disabled", signingKeysDir)
 	}
 
 	return &Config{
-		AccessTTL:     24 * time.Hour,
-		RefreshTTL:    7 * 24 * time.Hour,
-		AccessSecret:  accessSecret,
+		AccessTTL:     accessTTL,
+		RefreshTTL:    refreshTTL,
 		RefreshSecret: refreshSecret,
+
+		RememberMeRefreshTTL: rememberMeRefreshTTL,
+		SessionMaxLifetime:   sessionMaxLifetime,
+		MaxSessionsPerUser:   maxSessionsPerUser,
+
+		RefreshTokenGCInterval:  refreshTokenGCInterval,
+		RefreshTokenGCBatchSize: refreshTokenGCBatchSize,
+
+		SigningKeysDir:      signingKeysDir,
+		SigningKeys:         signingKeys,
+		KeyRotationInterval: keyRotationInterval,
+		KeyReloadInterval:   keyReloadInterval,
+
+		LoginMaxUserFailures: loginMaxUserFailures,
+		LoginMaxIPFailures:   loginMaxIPFailures,
+		LoginFailureWindow:   loginFailureWindow,
+		LoginLockoutBase:     loginLockoutBase,
+		LoginLockoutMax:      loginLockoutMax,
+
+		TrustedProxies: listFromEnv("TRUSTED_PROXY_SERVICES", "gateway"),
+		TokenRevokers:  listFromEnv("TOKEN_REVOKER_SERVICES", "user-service"),
+
+		TotpIssuer:        utils.GetEnv("TOTP_ISSUER", "Chat"),
+		TotpEncryptionKey: totpEncryptionKey[:],
+		LoginChallengeTTL: loginChallengeTTL,
+
+		PasswordResetTTL:           passwordResetTTL,
+		PasswordResetMaxRequests:   passwordResetMaxRequests,
+		PasswordResetMaxIPRequests: passwordResetMaxIPRequests,
+		PasswordResetWindow:        passwordResetWindow,
+
+		OIDCProviders: oidcProviders,
+		OIDCStateTTL:  oidcStateTTL,
+
+		OAuthIssuer:     strings.TrimSuffix(utils.GetEnv("OAUTH_ISSUER", "http://localhost:8080"), "/"),
+		OAuthCodeTTL:    oauthCodeTTL,
+		OAuthScopeRoles: oauthScopeRoles,
+
+		APIKeyAccessTTL:   apiKeyAccessTTL,
+		MaxAPIKeysPerUser: maxAPIKeysPerUser,
+
+		ImpersonationTTL: impersonationTTL,
 	}, nil
 }
+
+func durationFromEnv(key string, defaultValue time.Duration) (time.Duration, error) {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultValue, nil
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a duration: %w", key, err)
+	}
+	return d, nil
+}
+
+// scopeRolesFromEnv parses a list such as "chat.read=USER,chat.admin=ADMIN".
+func scopeRolesFromEnv(key string) (map[string]string, error) {
+	scopeRoles := make(map[string]string)
+
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		scope, role, ok := strings.Cut(pair, "=")
+		if !ok || scope == "" || role == "" {
+			return nil, fmt.Errorf("%s must be a comma separated list of scope=ROLE pairs", key)
+		}
+		scopeRoles[scope] = role
+	}
+	return scopeRoles, nil
+}
+
+// listFromEnv parses a comma separated list, ignoring empty items.
+func listFromEnv(key string, defaultValue string) []string {
+	var items []string
+	for item := range strings.SplitSeq(utils.GetEnv(key, defaultValue), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func intFromEnv(key string, defaultValue int) (int, error) {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultValue, nil
+	}
+
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer: %w", key, err)
+	}
+	return n, nil
+}
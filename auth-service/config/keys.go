@@ -0,0 +1,137 @@
+package config
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	AlgorithmEdDSA = "EdDSA"
+	AlgorithmRS256 = "RS256"
+
+	signingKeyExt = ".pem"
+)
+
+// SigningKey is a private key used to sign access tokens. The key ID is the
+// file name without its extension and is published as the JWT "kid" header.
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	Key       crypto.Signer
+	CreatedAt time.Time
+}
+
+func (k SigningKey) Public() crypto.PublicKey {
+	return k.Key.Public()
+}
+
+// LoadSigningKeys reads every PEM encoded Ed25519 or RSA private key in dir,
+// oldest first. A missing directory yields no keys.
+func LoadSigningKeys(dir string) ([]SigningKey, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read signing keys directory: %w", err)
+	}
+
+	keys := make([]SigningKey, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != signingKeyExt {
+			continue
+		}
+
+		key, err := loadSigningKey(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	slices.SortFunc(keys, func(a, b SigningKey) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return keys, nil
+}
+
+func loadSigningKey(path string) (SigningKey, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("failed to stat signing key %s: %w", path, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("failed to read signing key %s: %w", path, err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return SigningKey{}, fmt.Errorf("signing key %s is not PEM encoded", path)
+	}
+
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		err = fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("failed to parse signing key %s: %w", path, err)
+	}
+
+	key := SigningKey{
+		ID:        strings.TrimSuffix(filepath.Base(path), signingKeyExt),
+		CreatedAt: info.ModTime(),
+	}
+
+	switch k := parsed.(type) {
+	case ed25519.PrivateKey:
+		key.Algorithm = AlgorithmEdDSA
+		key.Key = k
+	case *rsa.PrivateKey:
+		key.Algorithm = AlgorithmRS256
+		key.Key = k
+	default:
+		return SigningKey{}, fmt.Errorf("signing key %s must be Ed25519 or RSA", path)
+	}
+
+	return key, nil
+}
+
+// WriteSigningKey stores key in dir in the format LoadSigningKeys expects.
+func WriteSigningKey(dir string, key SigningKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key.Key)
+	if err != nil {
+		return fmt.Errorf("failed to encode signing key: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create signing keys directory: %w", err)
+	}
+
+	path := filepath.Join(dir, key.ID+signingKeyExt)
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write signing key: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// OIDCProvider is an external OpenID Connect identity provider users may sign
+// in with. Each one is configured from OIDC_<NAME>_* variables, where NAME is
+// listed in OIDC_PROVIDERS.
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	// LinkByEmail signs users into the existing account with the same email
+	// when the provider reports the email as verified. Local emails are not
+	// verified, so only enable it when accounts cannot set arbitrary emails;
+	// otherwise anyone can claim an address ahead of its owner. Off by
+	// default.
+	LinkByEmail bool
+	// AutoProvision creates an account on first sign-in when no account is
+	// linked to the identity. Off by default.
+	AutoProvision bool
+}
+
+func loadOIDCProviders() ([]OIDCProvider, error) {
+	names := os.Getenv("OIDC_PROVIDERS")
+	if names == "" {
+		return nil, nil
+	}
+
+	var providers []OIDCProvider
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		provider, err := loadOIDCProvider(name)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
+
+func loadOIDCProvider(name string) (OIDCProvider, error) {
+	prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+
+	provider := OIDCProvider{
+		Name:         name,
+		Issuer:       os.Getenv(prefix + "ISSUER"),
+		ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+		ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+		RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+		Scopes:       []string{"openid", "profile", "email"},
+	}
+
+	if provider.Issuer == "" || provider.ClientID == "" || provider.RedirectURL == "" {
+		return provider, fmt.Errorf("%sISSUER, %sCLIENT_ID and %sREDIRECT_URL must be set", prefix, prefix, prefix)
+	}
+
+	if scopes := os.Getenv(prefix + "SCOPES"); scopes != "" {
+		provider.Scopes = strings.Fields(scopes)
+	}
+
+	var err error
+	if provider.LinkByEmail, err = boolFromEnv(prefix+"LINK_BY_EMAIL", false); err != nil {
+		return provider, err
+	}
+	if provider.AutoProvision, err = boolFromEnv(prefix+"AUTO_PROVISION", false); err != nil {
+		return provider, err
+	}
+
+	return provider, nil
+}
+
+func boolFromEnv(key string, defaultValue bool) (bool, error) {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultValue, nil
+	}
+
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, fmt.Errorf("%s must be a boolean: %w", key, err)
+	}
+	return b, nil
+}
@@ -3,7 +3,93 @@ package dto
 import "time"
 
 type SaveRefreshToken struct {
-	RefreshToken string
-	UserID       string
+	TokenHash        string
+	UserID           string
+	FamilyID         string
+	SessionStartedAt time.Time
+	ClientIP         string
+	UserAgent        string
+	RememberMe       bool
+	ClientID         string
+	Scope            string
+	Expiration       time.Time
+}
+
+type SaveSecurityEvent struct {
+	Type     string
+	UserID   string
+	ActorID  string
+	FamilyID string
+	Details  string
+}
+
+type RevokeRefreshTokens struct {
+	UserID          string
+	FamilyID        string
+	ClientID        string
+	ExceptFamilyIDs []string
+}
+
+type SaveLoginChallenge struct {
+	TokenHash  string
+	UserID     string
+	Username   string
+	RememberMe bool
+	Expiration time.Time
+}
+
+type SavePasswordResetToken struct {
+	TokenHash  string
+	UserID     string
+	Expiration time.Time
+}
+
+type SaveFederatedLoginState struct {
+	StateHash    string
+	Provider     string
+	CodeVerifier string
+	Nonce        string
+	LinkUserID   string
+	RememberMe   bool
 	Expiration   time.Time
 }
+
+type SaveFederatedIdentity struct {
+	Provider string
+	Subject  string
+	UserID   string
+	Email    string
+}
+
+type SaveOAuthClient struct {
+	ID           string
+	SecretHash   string
+	Name         string
+	RedirectURIs []string
+	Scopes       []string
+	GrantTypes   []string
+	Public       bool
+	CreatedBy    string
+}
+
+type SaveOAuthAuthorizationCode struct {
+	CodeHash      string
+	ClientID      string
+	UserID        string
+	RedirectURI   string
+	Scope         string
+	CodeChallenge string
+	Nonce         string
+	AuthTime      time.Time
+	Expiration    time.Time
+}
+
+type SaveAPIKey struct {
+	KeyHash    string
+	Prefix     string
+	OwnerID    string
+	Name       string
+	Roles      []string
+	CreatedBy  string
+	Expiration *time.Time
+}
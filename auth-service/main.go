@@ -1,18 +1,26 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
+	"os"
+	"time"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/reflection"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 
+	"authkit/serviceauth"
+
 	"auth-service/config"
+	"auth-service/metrics"
+	"auth-service/migrations"
 	"auth-service/models"
+	"auth-service/notify"
 	pb "auth-service/pb"
 	"auth-service/repository"
 	"auth-service/server"
@@ -27,12 +35,17 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	db, err := initializeDatabase()
+	serviceAuth, err := serviceauth.ConfigFromEnv("auth-service")
+	if err != nil {
+		log.Fatalf("Failed to load service authentication config: %v", err)
+	}
+
+	db, err := initializeDatabase(cfg)
 	if err != nil {
 		log.Fatalf("Database initialization failed: %v", err)
 	}
 
-	userServiceConn, err := connectToUserService()
+	userServiceConn, err := connectToUserService(serviceAuth)
 	if err != nil {
 		log.Fatalf("Failed to connect to User Service: %v", err)
 	}
@@ -40,11 +53,44 @@ func main() {
 
 	userServiceClient := userpb.NewUserServiceClient(userServiceConn)
 
+	leaseRepository := repository.NewGormLeaseRepository(db)
+
+	keyring, err := service.NewKeyring(cfg, leaseRepository)
+	if err != nil {
+		log.Fatalf("Failed to initialize signing keys: %v", err)
+	}
+	go keyring.Run(context.Background())
+
 	authRepository := repository.NewGormAuthRepository(db)
-	authService := service.NewAuthService(authRepository, userServiceClient, cfg)
+	denylistRepository := repository.NewGormDenylistRepository(db)
+	go purgeDenylist(context.Background(), denylistRepository)
+
+	tokenSweeper := service.NewTokenSweeper(authRepository, leaseRepository, cfg)
+	go tokenSweeper.Run(context.Background())
+
+	go serveMetrics(utils.GetEnv("METRICS_PORT", "9090"))
+
+	loginGuard := service.NewLoginGuard(newLoginAttemptRepository(db), cfg)
+
+	twoFactorRepository := repository.NewGormTwoFactorRepository(db)
+	passwordResetRepository := repository.NewGormPasswordResetRepository(db)
+	federationRepository := repository.NewGormFederationRepository(db)
+	oauthRepository := repository.NewGormOAuthRepository(db)
+	apiKeyRepository := repository.NewGormAPIKeyRepository(db)
+
+	notifier, err := newNotifier()
+	if err != nil {
+		log.Fatalf("Failed to initialize notifier: %v", err)
+	}
+
+	authService := service.NewAuthService(authRepository, denylistRepository, loginGuard, twoFactorRepository,
+		passwordResetRepository, notifier, federationRepository, service.NewFederatedProviders(cfg),
+		oauthRepository, apiKeyRepository, userServiceClient, cfg, keyring)
+
+	go serveOAuth(utils.GetEnv("OAUTH_HTTP_PORT", "8080"), authService)
 
 	serverPort := utils.GetEnv("GRPC_PORT", "50051")
-	lis, s, err := setupGRPCServer(serverPort, authService)
+	lis, s, err := setupGRPCServer(serverPort, serviceAuth, authService)
 	if err != nil {
 		log.Fatalf("gRPC server setup failed: %v", err)
 	}
@@ -55,7 +101,7 @@ func main() {
 	}
 }
 
-func initializeDatabase() (*gorm.DB, error) {
+func initializeDatabase(cfg *config.Config) (*gorm.DB, error) {
 	mariadbURI := utils.GetEnv("MARIADB_URI", "user:secret@tcp(auth-db:3306)/authdb")
 	uriWithOptions := fmt.Sprintf("%s?charset=utf8mb4&parseTime=True&loc=Local", mariadbURI)
 
@@ -64,24 +110,114 @@ func initializeDatabase() (*gorm.DB, error) {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	err = db.AutoMigrate(&models.RefreshToken{})
+	err = migrations.HashRefreshTokens(db, func(token string) string {
+		return service.HashRefreshToken(cfg.RefreshSecret, token)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.AutoMigrate(&models.RefreshToken{}, &models.SecurityEvent{}, &models.DenylistEntry{}, &models.LoginAttempt{},
+		&models.TwoFactor{}, &models.RecoveryCode{}, &models.LoginChallenge{},
+		&models.PasswordResetToken{}, &models.Lease{},
+		&models.FederatedIdentity{}, &models.FederatedLoginState{},
+		&models.OAuthClient{}, &models.OAuthAuthorizationCode{}, &models.APIKey{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to run database migrations: %w", err)
 	}
 
+	// Tokens issued before families existed each become their own family.
+	err = db.Model(&models.RefreshToken{}).Where("family_id = ?", "").Update("family_id", gorm.Expr("id")).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to backfill refresh token families: %w", err)
+	}
+
+	err = db.Model(&models.RefreshToken{}).Where("session_started_at IS NULL").Update("session_started_at", gorm.Expr("created_at")).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to backfill refresh token sessions: %w", err)
+	}
+
 	return db, nil
 }
 
-func connectToUserService() (*grpc.ClientConn, error) {
+func newLoginAttemptRepository(db *gorm.DB) repository.LoginAttemptRepository {
+	store := utils.GetEnv("LOGIN_ATTEMPT_STORE", "database")
+	log.Println("Login attempt store:", store)
+	if store == "memory" {
+		return repository.NewMemoryLoginAttemptRepository()
+	}
+	return repository.NewGormLoginAttemptRepository(db)
+}
+
+// newNotifier picks how account messages are delivered. Only the development
+// sender exists for now; NOTIFIER_FILE redirects it from stdout to a file.
+func newNotifier() (notify.Notifier, error) {
+	path := utils.GetEnv("NOTIFIER_FILE", "")
+	if path == "" {
+		return notify.NewLogNotifier(log.New(os.Stdout, "notify: ", log.LstdFlags)), nil
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open notifier file: %w", err)
+	}
+	return notify.NewLogNotifier(log.New(f, "", log.LstdFlags)), nil
+}
+
+func purgeDenylist(ctx context.Context, denylist repository.DenylistRepository) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := denylist.PurgeExpired(ctx); err != nil {
+				log.Printf("Failed to purge access token denylist: %v", err)
+			}
+		}
+	}
+}
+
+func serveMetrics(port string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+
+	log.Println("Metrics server started on port", port)
+	if err := http.ListenAndServe(fmt.Sprintf(":%s", port), mux); err != nil {
+		log.Printf("Metrics server stopped: %v", err)
+	}
+}
+
+func serveOAuth(port string, authService service.AuthService) {
+	// Clients reach these endpoints directly, so slow ones must not be able
+	// to hold connections open indefinitely.
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%s", port),
+		Handler:           server.NewOAuthHandler(authService),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		IdleTimeout:       time.Minute,
+	}
+
+	log.Println("OAuth server started on port", port)
+	if err := srv.ListenAndServe(); err != nil {
+		log.Fatalf("OAuth server stopped: %v", err)
+	}
+}
+
+func connectToUserService(serviceAuth *serviceauth.Config) (*grpc.ClientConn, error) {
 	userServiceAddr := utils.GetEnv("USER_SERVICE_URL", "user-service:50051")
-	conn, err := grpc.NewClient(userServiceAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.NewClient(userServiceAddr, serviceauth.DialOptions(serviceAuth, "user-service")...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to User Service: %w", err)
 	}
 	return conn, nil
 }
 
-func setupGRPCServer(port string, authService service.AuthService) (net.Listener, *grpc.Server, error) {
+func setupGRPCServer(port string, serviceAuth *serviceauth.Config, authService service.AuthService) (net.Listener, *grpc.Server, error) {
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to listen on port %s: %w", port, err)
@@ -89,7 +225,7 @@ func setupGRPCServer(port string, authService service.AuthService) (net.Listener
 
 	authServer := server.NewAuthServer(authService)
 
-	s := grpc.NewServer()
+	s := grpc.NewServer(serviceauth.ServerOptions(serviceAuth, server.Policy)...)
 	pb.RegisterAuthServiceServer(s, authServer)
 
 	enableReflection := utils.GetEnv("REFLECTION", "false")
@@ -0,0 +1,31 @@
+// Package metrics defines the Prometheus metrics exported by auth-service.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	RefreshTokensPurged = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "auth_refresh_tokens_purged_total",
+		Help: "Expired or revoked refresh tokens deleted by the sweeper.",
+	})
+
+	RefreshTokenSweeps = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_refresh_token_sweeps_total",
+		Help: "Refresh token sweeps run by this replica, by result.",
+	}, []string{"result"})
+
+	RefreshTokenSweeperLeader = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "auth_refresh_token_sweeper_leader",
+		Help: "1 if this replica currently holds the refresh token sweeper lease.",
+	})
+)
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
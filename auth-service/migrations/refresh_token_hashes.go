@@ -0,0 +1,65 @@
+// Package migrations holds data migrations that AutoMigrate cannot express on
+// its own. Each one is idempotent and runs on every start before AutoMigrate.
+package migrations
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+const hashRefreshTokensBatchSize = 500
+
+type legacyRefreshToken struct {
+	ID    string
+	Token string
+}
+
+// HashRefreshTokens converts refresh tokens stored in plaintext in the legacy
+// "token" column into keyed hashes in "token_hash", then drops the old column.
+// Converting rather than deleting keeps existing sessions signed in.
+func HashRefreshTokens(db *gorm.DB, hash func(token string) string) error {
+	const table = "refresh_tokens"
+
+	migrator := db.Migrator()
+	if !migrator.HasTable(table) || !migrator.HasColumn(table, "token") {
+		return nil
+	}
+
+	if !migrator.HasColumn(table, "token_hash") {
+		if err := db.Exec("ALTER TABLE refresh_tokens ADD COLUMN token_hash char(64) NULL").Error; err != nil {
+			return fmt.Errorf("failed to add token_hash column: %w", err)
+		}
+	}
+
+	for {
+		var rows []legacyRefreshToken
+		err := db.Table(table).Select("id", "token").
+			Where("token_hash IS NULL OR token_hash = ''").
+			Limit(hashRefreshTokensBatchSize).
+			Find(&rows).Error
+		if err != nil {
+			return fmt.Errorf("failed to read plaintext refresh tokens: %w", err)
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			for _, row := range rows {
+				if err := tx.Table(table).Where("id = ?", row.ID).Update("token_hash", hash(row.Token)).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to hash refresh tokens: %w", err)
+		}
+	}
+
+	if err := migrator.DropColumn(table, "token"); err != nil {
+		return fmt.Errorf("failed to drop plaintext token column: %w", err)
+	}
+	return nil
+}
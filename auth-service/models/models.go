@@ -5,9 +5,163 @@ import (
 )
 
 type RefreshToken struct {
+	ID               string     `gorm:"primaryKey;type:varchar(36);default:REPLACE(UUID(),'-','')"`
+	TokenHash        string     `gorm:"not null;uniqueIndex;type:char(64)"`
+	UserID           string     `gorm:"not null;type:varchar(36);index"`
+	FamilyID         string     `gorm:"not null;type:varchar(36);index"`
+	SessionStartedAt time.Time  `gorm:"type:datetime(3)"`
+	ClientIP         string     `gorm:"type:varchar(45)"`
+	UserAgent        string     `gorm:"type:varchar(255)"`
+	RememberMe       bool       `gorm:"not null;default:false"`
+	ClientID         string     `gorm:"type:varchar(64);index"` // set on sessions granted to OAuth clients
+	Scope            string     `gorm:"type:varchar(1024)"`
+	ExpiresAt        time.Time  `gorm:"not null"`
+	RotatedAt        *time.Time `gorm:"index"`
+	RevokedAt        *time.Time `gorm:"index"`
+	CreatedAt        time.Time  `gorm:"autoCreateTime"`
+}
+
+type SecurityEvent struct {
+	ID        string    `gorm:"primaryKey;type:varchar(36);default:REPLACE(UUID(),'-','')"`
+	Type      string    `gorm:"not null;type:varchar(64);index"`
+	UserID    string    `gorm:"type:varchar(36);index"`
+	ActorID   string    `gorm:"type:varchar(36);index"` // set when someone acted on the user's behalf
+	FamilyID  string    `gorm:"type:varchar(36)"`
+	Details   string    `gorm:"type:text"`
+	CreatedAt time.Time `gorm:"autoCreateTime;index"`
+}
+
+// DenylistEntry revokes access tokens before they expire. Keys are either
+// "jti:<token id>" for a single token or "user:<user id>" for every token
+// issued to that user up to RevokedAt.
+type DenylistEntry struct {
+	Key       string    `gorm:"primaryKey;type:varchar(80)"`
+	RevokedAt time.Time `gorm:"not null;precision:6"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
+
+// LoginAttempt tracks failed logins for a throttling key such as a username
+// or a client IP.
+type LoginAttempt struct {
+	Key           string `gorm:"primaryKey;type:varchar(320)"`
+	Failures      int    `gorm:"not null"`
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
+
+type TwoFactor struct {
+	UserID       string `gorm:"primaryKey;type:varchar(36)"`
+	Secret       string `gorm:"not null;type:varchar(128)"`
+	LastUsedStep int64  `gorm:"not null;default:0"`
+	ConfirmedAt  *time.Time
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+}
+
+type RecoveryCode struct {
+	ID        string `gorm:"primaryKey;type:varchar(36);default:REPLACE(UUID(),'-','')"`
+	UserID    string `gorm:"not null;type:varchar(36);index"`
+	CodeHash  string `gorm:"not null;type:varchar(64);index"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// LoginChallenge is handed out instead of tokens when a user with two-factor
+// authentication enabled passes the password check.
+type LoginChallenge struct {
+	ID         string    `gorm:"primaryKey;type:varchar(36);default:REPLACE(UUID(),'-','')"`
+	TokenHash  string    `gorm:"not null;uniqueIndex;type:varchar(64)"`
+	UserID     string    `gorm:"not null;type:varchar(36)"`
+	Username   string    `gorm:"not null"`
+	RememberMe bool      `gorm:"not null;default:false"`
+	Attempts   int       `gorm:"not null;default:0"`
+	ExpiresAt  time.Time `gorm:"not null;index"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+}
+
+type PasswordResetToken struct {
 	ID        string    `gorm:"primaryKey;type:varchar(36);default:REPLACE(UUID(),'-','')"`
-	Token     string    `gorm:"not null;uniqueIndex;type:varchar(36)"`
+	TokenHash string    `gorm:"not null;uniqueIndex;type:varchar(64)"`
 	UserID    string    `gorm:"not null;type:varchar(36);index"`
 	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
 	CreatedAt time.Time `gorm:"autoCreateTime"`
 }
+
+// FederatedIdentity links an account at an external identity provider to a
+// local user.
+type FederatedIdentity struct {
+	ID        string    `gorm:"primaryKey;type:varchar(36);default:REPLACE(UUID(),'-','')"`
+	Provider  string    `gorm:"not null;type:varchar(64);uniqueIndex:idx_federated_identity_subject"`
+	Subject   string    `gorm:"not null;type:varchar(255);uniqueIndex:idx_federated_identity_subject"`
+	UserID    string    `gorm:"not null;type:varchar(36);index"`
+	Email     string    `gorm:"type:varchar(320)"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// FederatedLoginState keeps what is needed to finish an authorization code
+// flow while the user is away at the identity provider.
+type FederatedLoginState struct {
+	ID           string `gorm:"primaryKey;type:varchar(36);default:REPLACE(UUID(),'-','')"`
+	StateHash    string `gorm:"not null;uniqueIndex;type:varchar(64)"`
+	Provider     string `gorm:"not null;type:varchar(64)"`
+	CodeVerifier string `gorm:"not null;type:varchar(128)"`
+	Nonce        string `gorm:"not null;type:varchar(64)"`
+	// LinkUserID is set when a signed-in user links the identity explicitly.
+	LinkUserID string    `gorm:"type:varchar(36)"`
+	RememberMe bool      `gorm:"not null;default:false"`
+	ExpiresAt  time.Time `gorm:"not null;index"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+}
+
+// OAuthClient is a third-party application allowed to obtain tokens from the
+// authorization server. Public clients have no secret and must use PKCE.
+type OAuthClient struct {
+	ID           string    `gorm:"primaryKey;type:varchar(64)"`
+	SecretHash   string    `gorm:"type:varchar(64)"`
+	Name         string    `gorm:"not null"`
+	RedirectURIs string    `gorm:"type:text"`          // space separated
+	Scopes       string    `gorm:"type:varchar(1024)"` // space separated
+	GrantTypes   string    `gorm:"type:varchar(255)"`  // space separated
+	Public       bool      `gorm:"not null;default:false"`
+	CreatedBy    string    `gorm:"type:varchar(36)"`
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+}
+
+type OAuthAuthorizationCode struct {
+	ID            string    `gorm:"primaryKey;type:varchar(36);default:REPLACE(UUID(),'-','')"`
+	CodeHash      string    `gorm:"not null;uniqueIndex;type:varchar(64)"`
+	ClientID      string    `gorm:"not null;type:varchar(64)"`
+	UserID        string    `gorm:"not null;type:varchar(36)"`
+	RedirectURI   string    `gorm:"not null;type:text"`
+	Scope         string    `gorm:"type:varchar(1024)"`
+	CodeChallenge string    `gorm:"not null;type:varchar(128)"`
+	Nonce         string    `gorm:"type:varchar(255)"`
+	AuthTime      time.Time `gorm:"not null"`
+	ExpiresAt     time.Time `gorm:"not null;index"`
+	CreatedAt     time.Time `gorm:"autoCreateTime"`
+}
+
+// APIKey is a long-lived credential for scripts and bots, exchanged for short
+// lived access tokens. Roles restricts those tokens to a subset of the owner's
+// roles; only the key's hash and a display prefix are kept.
+type APIKey struct {
+	ID         string `gorm:"primaryKey;type:varchar(36);default:REPLACE(UUID(),'-','')"`
+	KeyHash    string `gorm:"not null;uniqueIndex;type:varchar(64)"`
+	Prefix     string `gorm:"not null;type:varchar(16)"`
+	OwnerID    string `gorm:"not null;type:varchar(36);index"`
+	Name       string `gorm:"not null"`
+	Roles      string `gorm:"type:varchar(1024)"` // space separated
+	CreatedBy  string `gorm:"type:varchar(36)"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+}
+
+// Lease elects a single replica to run a background job. The holder renews it
+// before ExpiresAt; once it lapses any replica may take it over.
+type Lease struct {
+	Name      string    `gorm:"primaryKey;type:varchar(64)"`
+	Holder    string    `gorm:"not null;type:varchar(128)"`
+	ExpiresAt time.Time `gorm:"not null"`
+}
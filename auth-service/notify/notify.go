@@ -0,0 +1,37 @@
+// Package notify delivers account messages, such as password reset links, to
+// users.
+package notify
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+type PasswordResetMessage struct {
+	UserID    string
+	Username  string
+	Token     string
+	ExpiresAt time.Time
+}
+
+type Notifier interface {
+	SendPasswordReset(ctx context.Context, msg *PasswordResetMessage) error
+}
+
+// logNotifier writes messages to a logger instead of delivering them. It is
+// meant for local development, where the logger usually points at stdout or a
+// file the developer can read the reset token from.
+type logNotifier struct {
+	logger *log.Logger
+}
+
+func NewLogNotifier(logger *log.Logger) Notifier {
+	return &logNotifier{logger: logger}
+}
+
+func (n *logNotifier) SendPasswordReset(ctx context.Context, msg *PasswordResetMessage) error {
+	n.logger.Printf("password reset for user %s (%s): token %s, expires %s",
+		msg.Username, msg.UserID, msg.Token, msg.ExpiresAt.Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"auth-service/dto"
+	"auth-service/models"
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type APIKeyRepository interface {
+	SaveAPIKey(ctx context.Context, data *dto.SaveAPIKey) (*models.APIKey, error)
+	GetAPIKey(ctx context.Context, id string) (*models.APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error)
+	// ListActiveAPIKeys returns the owner's keys that are neither revoked nor
+	// expired, newest first.
+	ListActiveAPIKeys(ctx context.Context, ownerID string) ([]models.APIKey, error)
+	CountActiveAPIKeys(ctx context.Context, ownerID string) (int64, error)
+	// RevokeAPIKey revokes the key if it is still active. An empty ownerID
+	// matches keys of any owner.
+	RevokeAPIKey(ctx context.Context, id, ownerID string) error
+	TouchAPIKey(ctx context.Context, id string) error
+}
+
+type gormAPIKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewGormAPIKeyRepository(db *gorm.DB) APIKeyRepository {
+	return &gormAPIKeyRepository{db: db}
+}
+
+func (r *gormAPIKeyRepository) SaveAPIKey(ctx context.Context, data *dto.SaveAPIKey) (*models.APIKey, error) {
+	key := &models.APIKey{
+		KeyHash:   data.KeyHash,
+		Prefix:    data.Prefix,
+		OwnerID:   data.OwnerID,
+		Name:      data.Name,
+		Roles:     strings.Join(data.Roles, " "),
+		CreatedBy: data.CreatedBy,
+		ExpiresAt: data.Expiration,
+	}
+
+	err := r.db.WithContext(ctx).Create(key).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil, ErrDuplicateKey
+	} else if err != nil {
+		return nil, err
+	}
+
+	// The ID is generated by the database.
+	err = r.db.WithContext(ctx).Where("key_hash = ?", data.KeyHash).First(key).Error
+	return key, err
+}
+
+func (r *gormAPIKeyRepository) GetAPIKey(ctx context.Context, id string) (*models.APIKey, error) {
+	key := &models.APIKey{}
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrEntityNotFound
+	}
+	return key, err
+}
+
+func (r *gormAPIKeyRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	key := &models.APIKey{}
+	err := r.db.WithContext(ctx).Where("key_hash = ?", keyHash).First(key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrEntityNotFound
+	}
+	return key, err
+}
+
+func (r *gormAPIKeyRepository) ListActiveAPIKeys(ctx context.Context, ownerID string) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := r.active(ctx, ownerID).Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+func (r *gormAPIKeyRepository) CountActiveAPIKeys(ctx context.Context, ownerID string) (int64, error) {
+	var count int64
+	err := r.active(ctx, ownerID).Model(&models.APIKey{}).Count(&count).Error
+	return count, err
+}
+
+func (r *gormAPIKeyRepository) RevokeAPIKey(ctx context.Context, id, ownerID string) error {
+	query := r.db.WithContext(ctx).Model(&models.APIKey{}).Where("id = ? AND revoked_at IS NULL", id)
+	if ownerID != "" {
+		query = query.Where("owner_id = ?", ownerID)
+	}
+
+	result := query.Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrEntityNotFound
+	}
+	return nil
+}
+
+func (r *gormAPIKeyRepository) TouchAPIKey(ctx context.Context, id string) error {
+	return r.db.WithContext(ctx).Model(&models.APIKey{}).Where("id = ?", id).Update("last_used_at", time.Now()).Error
+}
+
+func (r *gormAPIKeyRepository) active(ctx context.Context, ownerID string) *gorm.DB {
+	return r.db.WithContext(ctx).
+		Where("owner_id = ? AND revoked_at IS NULL", ownerID).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now())
+}
@@ -5,15 +5,21 @@ import (
 	"auth-service/models"
 	"context"
 	"errors"
+	"time"
 
 	"gorm.io/gorm"
 )
 
 type AuthRepository interface {
 	SaveRefreshToken(ctx context.Context, data *dto.SaveRefreshToken) error
-	GetRefreshToken(ctx context.Context, token string) (*models.RefreshToken, error)
+	GetRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	ListActiveRefreshTokens(ctx context.Context, userID string) ([]models.RefreshToken, error)
+	IsFamilyRevoked(ctx context.Context, familyID string) (bool, error)
 	DeleteRefreshTokenById(ctx context.Context, id string) error
-	RotateRefreshToken(ctx context.Context, oldToken string, newToken *dto.SaveRefreshToken) error
+	RotateRefreshToken(ctx context.Context, oldTokenHash string, newToken *dto.SaveRefreshToken) error
+	RevokeRefreshTokens(ctx context.Context, filter *dto.RevokeRefreshTokens) (int64, error)
+	SaveSecurityEvent(ctx context.Context, data *dto.SaveSecurityEvent) error
+	PurgeRefreshTokens(ctx context.Context, limit int) (int64, error)
 }
 
 type gormAuthRepository struct {
@@ -25,12 +31,9 @@ func NewGormAuthRepository(db *gorm.DB) AuthRepository {
 }
 
 func (r *gormAuthRepository) SaveRefreshToken(ctx context.Context, data *dto.SaveRefreshToken) error {
-	rt := &models.RefreshToken{
-		Token:     data.RefreshToken,
-		ExpiresAt: data.Expiration,
-	}
+	rt := newRefreshTokenModel(data)
 
-	err := r.db.Create(&rt).Error
+	err := r.db.WithContext(ctx).Create(&rt).Error
 
 	if errors.Is(err, gorm.ErrDuplicatedKey) {
 		return ErrDuplicateKey
@@ -39,8 +42,8 @@ func (r *gormAuthRepository) SaveRefreshToken(ctx context.Context, data *dto.Sav
 	return err
 }
 
-func (r *gormAuthRepository) GetRefreshToken(ctx context.Context, token string) (*models.RefreshToken, error) {
-	rt := &models.RefreshToken{Token: token}
+func (r *gormAuthRepository) GetRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	rt := &models.RefreshToken{TokenHash: tokenHash}
 	if err := r.db.WithContext(ctx).Where(&rt).First(&rt).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, ErrEntityNotFound
@@ -50,6 +53,29 @@ func (r *gormAuthRepository) GetRefreshToken(ctx context.Context, token string)
 	return rt, nil
 }
 
+// ListActiveRefreshTokens returns the current token of every live session the
+// user has, newest first.
+func (r *gormAuthRepository) ListActiveRefreshTokens(ctx context.Context, userID string) ([]models.RefreshToken, error) {
+	var tokens []models.RefreshToken
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND rotated_at IS NULL AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("created_at DESC").
+		Find(&tokens).Error
+	return tokens, err
+}
+
+// IsFamilyRevoked reports whether the session has been revoked as a whole.
+// Unknown families count as revoked.
+func (r *gormAuthRepository) IsFamilyRevoked(ctx context.Context, familyID string) (bool, error) {
+	var live int64
+	err := r.db.WithContext(ctx).
+		Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Limit(1).
+		Count(&live).Error
+	return live == 0, err
+}
+
 func (r *gormAuthRepository) DeleteRefreshTokenById(ctx context.Context, id string) error {
 	result := r.db.WithContext(ctx).Where("ID = ?", id).Delete(&models.RefreshToken{})
 
@@ -64,23 +90,21 @@ func (r *gormAuthRepository) DeleteRefreshTokenById(ctx context.Context, id stri
 	return nil
 }
 
-func (r *gormAuthRepository) RotateRefreshToken(ctx context.Context, oldToken string, newToken *dto.SaveRefreshToken) error {
+func (r *gormAuthRepository) RotateRefreshToken(ctx context.Context, oldTokenHash string, newToken *dto.SaveRefreshToken) error {
 	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		result := tx.Where("token = ?", oldToken).Delete(&models.RefreshToken{})
+		result := tx.Model(&models.RefreshToken{}).
+			Where("token_hash = ? AND rotated_at IS NULL AND revoked_at IS NULL", oldTokenHash).
+			Update("rotated_at", time.Now())
 
 		if result.Error != nil {
 			return result.Error
 		}
 
 		if result.RowsAffected == 0 {
-			return ErrEntityNotFound
+			return ErrTokenReused
 		}
 
-		rt := &models.RefreshToken{
-			Token:     newToken.RefreshToken,
-			UserID:    newToken.UserID,
-			ExpiresAt: newToken.Expiration,
-		}
+		rt := newRefreshTokenModel(newToken)
 
 		if err := tx.Create(&rt).Error; err != nil {
 			return err
@@ -89,3 +113,76 @@ func (r *gormAuthRepository) RotateRefreshToken(ctx context.Context, oldToken st
 		return nil
 	})
 }
+
+// RevokeRefreshTokens marks every unrevoked token matching the filter as
+// revoked and reports how many distinct sessions (token families) were hit.
+func (r *gormAuthRepository) RevokeRefreshTokens(ctx context.Context, filter *dto.RevokeRefreshTokens) (int64, error) {
+	if filter.UserID == "" && filter.FamilyID == "" && filter.ClientID == "" {
+		return 0, ErrMissingFilter
+	}
+
+	var revoked int64
+
+	matching := func(db *gorm.DB) *gorm.DB {
+		db = db.Model(&models.RefreshToken{}).Where("revoked_at IS NULL")
+		if filter.UserID != "" {
+			db = db.Where("user_id = ?", filter.UserID)
+		}
+		if filter.FamilyID != "" {
+			db = db.Where("family_id = ?", filter.FamilyID)
+		}
+		if filter.ClientID != "" {
+			db = db.Where("client_id = ?", filter.ClientID)
+		}
+		if len(filter.ExceptFamilyIDs) > 0 {
+			db = db.Where("family_id NOT IN ?", filter.ExceptFamilyIDs)
+		}
+		return db
+	}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Scopes(matching).Distinct("family_id").Count(&revoked).Error; err != nil {
+			return err
+		}
+		return tx.Scopes(matching).Update("revoked_at", time.Now()).Error
+	})
+
+	return revoked, err
+}
+
+func (r *gormAuthRepository) SaveSecurityEvent(ctx context.Context, data *dto.SaveSecurityEvent) error {
+	event := &models.SecurityEvent{
+		Type:     data.Type,
+		UserID:   data.UserID,
+		ActorID:  data.ActorID,
+		FamilyID: data.FamilyID,
+		Details:  data.Details,
+	}
+	return r.db.WithContext(ctx).Create(event).Error
+}
+
+// PurgeRefreshTokens deletes up to limit tokens that can no longer be used:
+// expired ones and revoked ones. Rotated tokens are kept until they expire so
+// that replaying them is still detected as reuse.
+func (r *gormAuthRepository) PurgeRefreshTokens(ctx context.Context, limit int) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("expires_at <= ? OR revoked_at IS NOT NULL", time.Now()).
+		Limit(limit).
+		Delete(&models.RefreshToken{})
+	return result.RowsAffected, result.Error
+}
+
+func newRefreshTokenModel(data *dto.SaveRefreshToken) *models.RefreshToken {
+	return &models.RefreshToken{
+		TokenHash:        data.TokenHash,
+		UserID:           data.UserID,
+		FamilyID:         data.FamilyID,
+		SessionStartedAt: data.SessionStartedAt,
+		ClientIP:         data.ClientIP,
+		UserAgent:        data.UserAgent,
+		RememberMe:       data.RememberMe,
+		ClientID:         data.ClientID,
+		Scope:            data.Scope,
+		ExpiresAt:        data.Expiration,
+	}
+}
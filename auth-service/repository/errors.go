@@ -4,3 +4,6 @@ import "errors"
 
 var ErrDuplicateKey = errors.New("repository: duplicate key constraint violation")
 var ErrEntityNotFound = errors.New("repository: entity was not found")
+var ErrTokenReused = errors.New("repository: refresh token was already rotated")
+var ErrMissingFilter = errors.New("repository: refusing to run an unfiltered bulk operation")
+var ErrAlreadyUsed = errors.New("repository: one-time credential was already used")
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"auth-service/dto"
+	"auth-service/models"
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type FederationRepository interface {
+	SaveFederatedLoginState(ctx context.Context, data *dto.SaveFederatedLoginState) error
+	// ConsumeFederatedLoginState deletes the state and returns it, so each
+	// authorization response can be redeemed once.
+	ConsumeFederatedLoginState(ctx context.Context, stateHash string) (*models.FederatedLoginState, error)
+	GetFederatedIdentity(ctx context.Context, provider, subject string) (*models.FederatedIdentity, error)
+	SaveFederatedIdentity(ctx context.Context, data *dto.SaveFederatedIdentity) error
+}
+
+type gormFederationRepository struct {
+	db *gorm.DB
+}
+
+func NewGormFederationRepository(db *gorm.DB) FederationRepository {
+	return &gormFederationRepository{db: db}
+}
+
+func (r *gormFederationRepository) SaveFederatedLoginState(ctx context.Context, data *dto.SaveFederatedLoginState) error {
+	state := &models.FederatedLoginState{
+		StateHash:    data.StateHash,
+		Provider:     data.Provider,
+		CodeVerifier: data.CodeVerifier,
+		Nonce:        data.Nonce,
+		LinkUserID:   data.LinkUserID,
+		RememberMe:   data.RememberMe,
+		ExpiresAt:    data.Expiration,
+	}
+	return r.db.WithContext(ctx).Create(state).Error
+}
+
+func (r *gormFederationRepository) ConsumeFederatedLoginState(ctx context.Context, stateHash string) (*models.FederatedLoginState, error) {
+	state := &models.FederatedLoginState{}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("state_hash = ?", stateHash).First(state).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrEntityNotFound
+		} else if err != nil {
+			return err
+		}
+		return tx.Delete(state).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func (r *gormFederationRepository) GetFederatedIdentity(ctx context.Context, provider, subject string) (*models.FederatedIdentity, error) {
+	identity := &models.FederatedIdentity{}
+	err := r.db.WithContext(ctx).Where("provider = ? AND subject = ?", provider, subject).First(identity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrEntityNotFound
+	}
+	return identity, err
+}
+
+func (r *gormFederationRepository) SaveFederatedIdentity(ctx context.Context, data *dto.SaveFederatedIdentity) error {
+	identity := &models.FederatedIdentity{
+		Provider: data.Provider,
+		Subject:  data.Subject,
+		UserID:   data.UserID,
+		Email:    data.Email,
+	}
+
+	err := r.db.WithContext(ctx).Create(identity).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrDuplicateKey
+	}
+	return err
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"auth-service/models"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type LeaseRepository interface {
+	// AcquireLease takes or renews the named lease for holder and reports
+	// whether holder owns it afterwards.
+	AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+}
+
+type gormLeaseRepository struct {
+	db *gorm.DB
+}
+
+func NewGormLeaseRepository(db *gorm.DB) LeaseRepository {
+	return &gormLeaseRepository{db: db}
+}
+
+func (r *gormLeaseRepository) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	acquired := false
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		lease := &models.Lease{}
+
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("name = ?", name).First(lease).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			lease = &models.Lease{Name: name, Holder: holder, ExpiresAt: now.Add(ttl)}
+			err = tx.Create(lease).Error
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				// Another replica created it first.
+				return nil
+			}
+			acquired = err == nil
+			return err
+		} else if err != nil {
+			return err
+		}
+
+		if lease.Holder != holder && lease.ExpiresAt.After(now) {
+			return nil
+		}
+
+		err = tx.Model(lease).Updates(map[string]any{"holder": holder, "expires_at": now.Add(ttl)}).Error
+		acquired = err == nil
+		return err
+	})
+
+	return acquired, err
+}
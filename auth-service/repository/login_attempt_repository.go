@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"auth-service/models"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type LoginAttemptRepository interface {
+	// GetLoginAttempt returns the attempts recorded for key, or a zero value
+	// record when there are none.
+	GetLoginAttempt(ctx context.Context, key string) (*models.LoginAttempt, error)
+	// RecordLoginFailure counts a failure for key and returns the updated
+	// record. Counting restarts when the previous failure is older than
+	// resetAfter and the key is not locked.
+	RecordLoginFailure(ctx context.Context, key string, resetAfter time.Duration) (*models.LoginAttempt, error)
+	LockLogin(ctx context.Context, key string, until time.Time) error
+	ResetLoginAttempts(ctx context.Context, key string) error
+}
+
+type gormLoginAttemptRepository struct {
+	db *gorm.DB
+}
+
+func NewGormLoginAttemptRepository(db *gorm.DB) LoginAttemptRepository {
+	return &gormLoginAttemptRepository{db: db}
+}
+
+func (r *gormLoginAttemptRepository) GetLoginAttempt(ctx context.Context, key string) (*models.LoginAttempt, error) {
+	attempt := &models.LoginAttempt{}
+	err := r.db.WithContext(ctx).Where("`key` = ?", key).First(attempt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.LoginAttempt{Key: key}, nil
+	}
+	return attempt, err
+}
+
+func (r *gormLoginAttemptRepository) RecordLoginFailure(ctx context.Context, key string, resetAfter time.Duration) (*models.LoginAttempt, error) {
+	attempt := &models.LoginAttempt{}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("`key` = ?", key).First(attempt).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			attempt = &models.LoginAttempt{Key: key}
+		} else if err != nil {
+			return err
+		}
+
+		recordFailure(attempt, time.Now(), resetAfter)
+		return tx.Save(attempt).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return attempt, nil
+}
+
+func (r *gormLoginAttemptRepository) LockLogin(ctx context.Context, key string, until time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&models.LoginAttempt{}).
+		Where("`key` = ?", key).
+		Update("locked_until", until).Error
+}
+
+func (r *gormLoginAttemptRepository) ResetLoginAttempts(ctx context.Context, key string) error {
+	return r.db.WithContext(ctx).Where("`key` = ?", key).Delete(&models.LoginAttempt{}).Error
+}
+
+// memoryLoginAttemptRepository keeps attempts in process memory. It is meant
+// for tests and single replica deployments.
+type memoryLoginAttemptRepository struct {
+	mu       sync.Mutex
+	attempts map[string]models.LoginAttempt
+}
+
+func NewMemoryLoginAttemptRepository() LoginAttemptRepository {
+	return &memoryLoginAttemptRepository{attempts: make(map[string]models.LoginAttempt)}
+}
+
+func (r *memoryLoginAttemptRepository) GetLoginAttempt(ctx context.Context, key string) (*models.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempt, ok := r.attempts[key]
+	if !ok {
+		attempt = models.LoginAttempt{Key: key}
+	}
+	return &attempt, nil
+}
+
+func (r *memoryLoginAttemptRepository) RecordLoginFailure(ctx context.Context, key string, resetAfter time.Duration) (*models.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempt, ok := r.attempts[key]
+	if !ok {
+		attempt = models.LoginAttempt{Key: key}
+	}
+	recordFailure(&attempt, time.Now(), resetAfter)
+	r.attempts[key] = attempt
+
+	return &attempt, nil
+}
+
+func (r *memoryLoginAttemptRepository) LockLogin(ctx context.Context, key string, until time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if attempt, ok := r.attempts[key]; ok {
+		attempt.LockedUntil = &until
+		r.attempts[key] = attempt
+	}
+	return nil
+}
+
+func (r *memoryLoginAttemptRepository) ResetLoginAttempts(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.attempts, key)
+	return nil
+}
+
+func recordFailure(attempt *models.LoginAttempt, now time.Time, resetAfter time.Duration) {
+	locked := attempt.LockedUntil != nil && now.Before(*attempt.LockedUntil)
+	if !locked && now.Sub(attempt.LastFailureAt) > resetAfter {
+		attempt.Failures = 0
+		attempt.LockedUntil = nil
+	}
+
+	attempt.Failures++
+	attempt.LastFailureAt = now
+}
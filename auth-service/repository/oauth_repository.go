@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"auth-service/dto"
+	"auth-service/models"
+	"context"
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OAuthRepository interface {
+	SaveOAuthClient(ctx context.Context, data *dto.SaveOAuthClient) error
+	GetOAuthClient(ctx context.Context, id string) (*models.OAuthClient, error)
+	DeleteOAuthClient(ctx context.Context, id string) error
+	SaveAuthorizationCode(ctx context.Context, data *dto.SaveOAuthAuthorizationCode) error
+	// ConsumeAuthorizationCode deletes the code and returns it, so each code
+	// can be redeemed once.
+	ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*models.OAuthAuthorizationCode, error)
+}
+
+type gormOAuthRepository struct {
+	db *gorm.DB
+}
+
+func NewGormOAuthRepository(db *gorm.DB) OAuthRepository {
+	return &gormOAuthRepository{db: db}
+}
+
+func (r *gormOAuthRepository) SaveOAuthClient(ctx context.Context, data *dto.SaveOAuthClient) error {
+	client := &models.OAuthClient{
+		ID:           data.ID,
+		SecretHash:   data.SecretHash,
+		Name:         data.Name,
+		RedirectURIs: strings.Join(data.RedirectURIs, " "),
+		Scopes:       strings.Join(data.Scopes, " "),
+		GrantTypes:   strings.Join(data.GrantTypes, " "),
+		Public:       data.Public,
+		CreatedBy:    data.CreatedBy,
+	}
+
+	err := r.db.WithContext(ctx).Create(client).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrDuplicateKey
+	}
+	return err
+}
+
+func (r *gormOAuthRepository) GetOAuthClient(ctx context.Context, id string) (*models.OAuthClient, error) {
+	client := &models.OAuthClient{}
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(client).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrEntityNotFound
+	}
+	return client, err
+}
+
+func (r *gormOAuthRepository) DeleteOAuthClient(ctx context.Context, id string) error {
+	result := r.db.WithContext(ctx).Where("id = ?", id).Delete(&models.OAuthClient{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrEntityNotFound
+	}
+	return nil
+}
+
+func (r *gormOAuthRepository) SaveAuthorizationCode(ctx context.Context, data *dto.SaveOAuthAuthorizationCode) error {
+	code := &models.OAuthAuthorizationCode{
+		CodeHash:      data.CodeHash,
+		ClientID:      data.ClientID,
+		UserID:        data.UserID,
+		RedirectURI:   data.RedirectURI,
+		Scope:         data.Scope,
+		CodeChallenge: data.CodeChallenge,
+		Nonce:         data.Nonce,
+		AuthTime:      data.AuthTime,
+		ExpiresAt:     data.Expiration,
+	}
+	return r.db.WithContext(ctx).Create(code).Error
+}
+
+func (r *gormOAuthRepository) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*models.OAuthAuthorizationCode, error) {
+	code := &models.OAuthAuthorizationCode{}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("code_hash = ?", codeHash).First(code).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrEntityNotFound
+		} else if err != nil {
+			return err
+		}
+		return tx.Delete(code).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return code, nil
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"auth-service/dto"
+	"auth-service/models"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PasswordResetRepository interface {
+	// SavePasswordResetToken stores a new token and discards any earlier
+	// unused ones, so only the latest reset link works.
+	SavePasswordResetToken(ctx context.Context, data *dto.SavePasswordResetToken) error
+	GetPasswordResetToken(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error)
+	// ConsumePasswordResetToken marks the token as used and returns it.
+	ConsumePasswordResetToken(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error)
+}
+
+type gormPasswordResetRepository struct {
+	db *gorm.DB
+}
+
+func NewGormPasswordResetRepository(db *gorm.DB) PasswordResetRepository {
+	return &gormPasswordResetRepository{db: db}
+}
+
+func (r *gormPasswordResetRepository) SavePasswordResetToken(ctx context.Context, data *dto.SavePasswordResetToken) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ? AND used_at IS NULL", data.UserID).Delete(&models.PasswordResetToken{}).Error
+		if err != nil {
+			return err
+		}
+
+		token := &models.PasswordResetToken{
+			TokenHash: data.TokenHash,
+			UserID:    data.UserID,
+			ExpiresAt: data.Expiration,
+		}
+		return tx.Create(token).Error
+	})
+}
+
+func (r *gormPasswordResetRepository) GetPasswordResetToken(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error) {
+	token := &models.PasswordResetToken{}
+	err := r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrEntityNotFound
+	}
+	return token, err
+}
+
+func (r *gormPasswordResetRepository) ConsumePasswordResetToken(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error) {
+	token := &models.PasswordResetToken{}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("token_hash = ?", tokenHash).First(token).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrEntityNotFound
+		} else if err != nil {
+			return err
+		}
+
+		if token.UsedAt != nil {
+			return ErrAlreadyUsed
+		}
+
+		now := time.Now()
+		token.UsedAt = &now
+		return tx.Model(token).Update("used_at", now).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
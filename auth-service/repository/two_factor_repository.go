@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"auth-service/dto"
+	"auth-service/models"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TwoFactorRepository interface {
+	// SaveTwoFactor starts an enrollment, replacing any unconfirmed one.
+	SaveTwoFactor(ctx context.Context, userID, secret string) error
+	GetTwoFactor(ctx context.Context, userID string) (*models.TwoFactor, error)
+	// ConfirmTwoFactor enables two-factor authentication and replaces the
+	// user's recovery codes.
+	ConfirmTwoFactor(ctx context.Context, userID string, recoveryCodeHashes []string) error
+	// UseTotpStep records that the code for step was accepted, rejecting
+	// steps at or before the last one used so a code cannot be replayed.
+	UseTotpStep(ctx context.Context, userID string, step int64) error
+	UseRecoveryCode(ctx context.Context, userID, codeHash string) error
+	// DeleteTwoFactor disables two-factor authentication and drops the
+	// user's recovery codes.
+	DeleteTwoFactor(ctx context.Context, userID string) error
+
+	SaveLoginChallenge(ctx context.Context, data *dto.SaveLoginChallenge) error
+	GetLoginChallenge(ctx context.Context, tokenHash string) (*models.LoginChallenge, error)
+	IncrementLoginChallengeAttempts(ctx context.Context, id string) error
+	DeleteLoginChallenge(ctx context.Context, id string) error
+}
+
+type gormTwoFactorRepository struct {
+	db *gorm.DB
+}
+
+func NewGormTwoFactorRepository(db *gorm.DB) TwoFactorRepository {
+	return &gormTwoFactorRepository{db: db}
+}
+
+func (r *gormTwoFactorRepository) SaveTwoFactor(ctx context.Context, userID, secret string) error {
+	twoFactor := &models.TwoFactor{
+		UserID: userID,
+		Secret: secret,
+	}
+	return r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoUpdates: clause.AssignmentColumns([]string{"secret", "last_used_step", "created_at"})}).
+		Create(twoFactor).Error
+}
+
+func (r *gormTwoFactorRepository) GetTwoFactor(ctx context.Context, userID string) (*models.TwoFactor, error) {
+	twoFactor := &models.TwoFactor{}
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(twoFactor).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrEntityNotFound
+	}
+	return twoFactor, err
+}
+
+func (r *gormTwoFactorRepository) ConfirmTwoFactor(ctx context.Context, userID string, recoveryCodeHashes []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.TwoFactor{}).
+			Where("user_id = ? AND confirmed_at IS NULL", userID).
+			Update("confirmed_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrEntityNotFound
+		}
+
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+
+		codes := make([]models.RecoveryCode, len(recoveryCodeHashes))
+		for i, hash := range recoveryCodeHashes {
+			codes[i] = models.RecoveryCode{UserID: userID, CodeHash: hash}
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+func (r *gormTwoFactorRepository) UseTotpStep(ctx context.Context, userID string, step int64) error {
+	result := r.db.WithContext(ctx).
+		Model(&models.TwoFactor{}).
+		Where("user_id = ? AND last_used_step < ?", userID, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAlreadyUsed
+	}
+	return nil
+}
+
+func (r *gormTwoFactorRepository) UseRecoveryCode(ctx context.Context, userID, codeHash string) error {
+	result := r.db.WithContext(ctx).
+		Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrEntityNotFound
+	}
+	return nil
+}
+
+func (r *gormTwoFactorRepository) DeleteTwoFactor(ctx context.Context, userID string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.TwoFactor{}).Error
+	})
+}
+
+func (r *gormTwoFactorRepository) SaveLoginChallenge(ctx context.Context, data *dto.SaveLoginChallenge) error {
+	challenge := &models.LoginChallenge{
+		TokenHash:  data.TokenHash,
+		UserID:     data.UserID,
+		Username:   data.Username,
+		RememberMe: data.RememberMe,
+		ExpiresAt:  data.Expiration,
+	}
+	return r.db.WithContext(ctx).Create(challenge).Error
+}
+
+func (r *gormTwoFactorRepository) GetLoginChallenge(ctx context.Context, tokenHash string) (*models.LoginChallenge, error) {
+	challenge := &models.LoginChallenge{}
+	err := r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(challenge).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrEntityNotFound
+	}
+	return challenge, err
+}
+
+func (r *gormTwoFactorRepository) IncrementLoginChallengeAttempts(ctx context.Context, id string) error {
+	return r.db.WithContext(ctx).
+		Model(&models.LoginChallenge{}).
+		Where("id = ?", id).
+		Update("attempts", gorm.Expr("attempts + 1")).Error
+}
+
+func (r *gormTwoFactorRepository) DeleteLoginChallenge(ctx context.Context, id string) error {
+	result := r.db.WithContext(ctx).Where("id = ?", id).Delete(&models.LoginChallenge{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrEntityNotFound
+	}
+	return nil
+}
@@ -20,16 +20,65 @@ func NewAuthServer(authService service.AuthService) *AuthServer {
 }
 
 func (s *AuthServer) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
-	tokens, err := s.authService.Login(ctx, req.GetUsername(), req.GetPassword())
+	result, err := s.authService.Login(ctx, req.GetUsername(), req.GetPassword(), req.GetRememberMe())
 	if err != nil {
 		return nil, err
 	}
 
+	if result.Challenge != nil {
+		return &pb.LoginResponse{
+			SecondFactorChallenge: &pb.SecondFactorChallenge{
+				ChallengeToken: result.Challenge.Token,
+				ExpiresAt:      timestamppb.New(result.Challenge.ExpiresAt),
+			},
+		}, nil
+	}
+
 	return &pb.LoginResponse{
+		Tokens: tokensToProtoTokens(result.Tokens),
+	}, nil
+}
+
+func (s *AuthServer) VerifySecondFactor(ctx context.Context, req *pb.VerifySecondFactorRequest) (*pb.VerifySecondFactorResponse, error) {
+	tokens, err := s.authService.VerifySecondFactor(ctx, req.GetChallengeToken(), req.GetCode())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.VerifySecondFactorResponse{
 		Tokens: tokensToProtoTokens(tokens),
 	}, nil
 }
 
+func (s *AuthServer) BeginTotpEnrollment(ctx context.Context, req *pb.BeginTotpEnrollmentRequest) (*pb.BeginTotpEnrollmentResponse, error) {
+	enrollment, err := s.authService.BeginTotpEnrollment(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.BeginTotpEnrollmentResponse{
+		Secret:          enrollment.Secret,
+		ProvisioningUri: enrollment.ProvisioningURI,
+	}, nil
+}
+
+func (s *AuthServer) ConfirmTotpEnrollment(ctx context.Context, req *pb.ConfirmTotpEnrollmentRequest) (*pb.ConfirmTotpEnrollmentResponse, error) {
+	recoveryCodes, err := s.authService.ConfirmTotpEnrollment(ctx, req.GetCode())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.ConfirmTotpEnrollmentResponse{RecoveryCodes: recoveryCodes}, nil
+}
+
+func (s *AuthServer) DisableTotp(ctx context.Context, req *pb.DisableTotpRequest) (*pb.DisableTotpResponse, error) {
+	if err := s.authService.DisableTotp(ctx, req.GetCode()); err != nil {
+		return nil, err
+	}
+
+	return &pb.DisableTotpResponse{}, nil
+}
+
 func (s *AuthServer) RotateRefreshToken(ctx context.Context, req *pb.RotateRefreshTokenRequest) (*pb.RotateRefreshTokenResponse, error) {
 	tokens, err := s.authService.RotateRefreshToken(ctx, req.GetRefreshToken())
 	if err != nil {
@@ -41,6 +90,271 @@ func (s *AuthServer) RotateRefreshToken(ctx context.Context, req *pb.RotateRefre
 	}, nil
 }
 
+func (s *AuthServer) Logout(ctx context.Context, req *pb.LogoutRequest) (*pb.LogoutResponse, error) {
+	if err := s.authService.Logout(ctx, req.GetRefreshToken()); err != nil {
+		return nil, err
+	}
+	return &pb.LogoutResponse{}, nil
+}
+
+func (s *AuthServer) RevokeSession(ctx context.Context, req *pb.RevokeSessionRequest) (*pb.RevokeSessionResponse, error) {
+	if err := s.authService.RevokeSession(ctx, req.GetSessionId()); err != nil {
+		return nil, err
+	}
+	return &pb.RevokeSessionResponse{}, nil
+}
+
+func (s *AuthServer) RevokeAllSessions(ctx context.Context, req *pb.RevokeAllSessionsRequest) (*pb.RevokeAllSessionsResponse, error) {
+	revoked, err := s.authService.RevokeAllSessions(ctx, req.GetUserId(), req.GetKeepCurrentSession())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.RevokeAllSessionsResponse{RevokedSessions: revoked}, nil
+}
+
+func (s *AuthServer) ListSessions(ctx context.Context, req *pb.ListSessionsRequest) (*pb.ListSessionsResponse, error) {
+	sessions, currentID, err := s.authService.ListSessions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pbSessions := make([]*pb.Session, 0, len(sessions))
+	for _, session := range sessions {
+		pbSessions = append(pbSessions, &pb.Session{
+			Id:         session.ID,
+			CreatedAt:  timestamppb.New(session.CreatedAt),
+			LastUsedAt: timestamppb.New(session.LastUsedAt),
+			ExpiresAt:  timestamppb.New(session.ExpiresAt),
+			ClientIp:   session.ClientIP,
+			UserAgent:  session.UserAgent,
+			Current:    session.ID == currentID,
+		})
+	}
+
+	return &pb.ListSessionsResponse{Sessions: pbSessions}, nil
+}
+
+func (s *AuthServer) GetPublicKeys(ctx context.Context, req *pb.GetPublicKeysRequest) (*pb.GetPublicKeysResponse, error) {
+	keys, err := s.authService.GetPublicKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pbKeys := make([]*pb.JsonWebKey, 0, len(keys))
+	for _, key := range keys {
+		pbKeys = append(pbKeys, &pb.JsonWebKey{
+			Kty: key.Kty,
+			Kid: key.Kid,
+			Use: key.Use,
+			Alg: key.Alg,
+			N:   key.N,
+			E:   key.E,
+			Crv: key.Crv,
+			X:   key.X,
+		})
+	}
+
+	return &pb.GetPublicKeysResponse{Keys: pbKeys}, nil
+}
+
+func (s *AuthServer) RevokeAccessTokens(ctx context.Context, req *pb.RevokeAccessTokensRequest) (*pb.RevokeAccessTokensResponse, error) {
+	if err := s.authService.RevokeAccessTokens(ctx, req.GetUserId()); err != nil {
+		return nil, err
+	}
+	return &pb.RevokeAccessTokensResponse{}, nil
+}
+
+func (s *AuthServer) UnlockAccount(ctx context.Context, req *pb.UnlockAccountRequest) (*pb.UnlockAccountResponse, error) {
+	if err := s.authService.UnlockAccount(ctx, req.GetUsername()); err != nil {
+		return nil, err
+	}
+	return &pb.UnlockAccountResponse{}, nil
+}
+
+func (s *AuthServer) CheckPasswordGuard(ctx context.Context, req *pb.CheckPasswordGuardRequest) (*pb.CheckPasswordGuardResponse, error) {
+	if err := s.authService.CheckPasswordGuard(ctx, req.GetUsername()); err != nil {
+		return nil, err
+	}
+	return &pb.CheckPasswordGuardResponse{}, nil
+}
+
+func (s *AuthServer) RecordPasswordFailure(ctx context.Context, req *pb.RecordPasswordFailureRequest) (*pb.RecordPasswordFailureResponse, error) {
+	if err := s.authService.RecordPasswordFailure(ctx, req.GetUsername()); err != nil {
+		return nil, err
+	}
+	return &pb.RecordPasswordFailureResponse{}, nil
+}
+
+func (s *AuthServer) RequestPasswordReset(ctx context.Context, req *pb.RequestPasswordResetRequest) (*pb.RequestPasswordResetResponse, error) {
+	if err := s.authService.RequestPasswordReset(ctx, req.GetUsername()); err != nil {
+		return nil, err
+	}
+	return &pb.RequestPasswordResetResponse{}, nil
+}
+
+func (s *AuthServer) ConfirmPasswordReset(ctx context.Context, req *pb.ConfirmPasswordResetRequest) (*pb.ConfirmPasswordResetResponse, error) {
+	if err := s.authService.ConfirmPasswordReset(ctx, req.GetToken(), req.GetNewPassword()); err != nil {
+		return nil, err
+	}
+	return &pb.ConfirmPasswordResetResponse{}, nil
+}
+
+func (s *AuthServer) BeginFederatedLogin(ctx context.Context, req *pb.BeginFederatedLoginRequest) (*pb.BeginFederatedLoginResponse, error) {
+	redirect, err := s.authService.BeginFederatedLogin(ctx, req.GetProvider(), req.GetLink(), req.GetRememberMe())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.BeginFederatedLoginResponse{
+		AuthorizationUrl: redirect.URL,
+		State:            redirect.State,
+		ExpiresAt:        timestamppb.New(redirect.ExpiresAt),
+	}, nil
+}
+
+func (s *AuthServer) CompleteFederatedLogin(ctx context.Context, req *pb.CompleteFederatedLoginRequest) (*pb.CompleteFederatedLoginResponse, error) {
+	tokens, err := s.authService.CompleteFederatedLogin(ctx, req.GetState(), req.GetCode())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CompleteFederatedLoginResponse{Tokens: tokensToProtoTokens(tokens)}, nil
+}
+
+func (s *AuthServer) RegisterOAuthClient(ctx context.Context, req *pb.RegisterOAuthClientRequest) (*pb.RegisterOAuthClientResponse, error) {
+	registration, err := s.authService.RegisterOAuthClient(ctx, &service.OAuthClientSpec{
+		Name:         req.GetName(),
+		RedirectURIs: req.GetRedirectUris(),
+		Scopes:       req.GetScopes(),
+		GrantTypes:   req.GetGrantTypes(),
+		Public:       req.GetPublic(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.RegisterOAuthClientResponse{
+		ClientId:     registration.ClientID,
+		ClientSecret: registration.ClientSecret,
+	}, nil
+}
+
+func (s *AuthServer) DeleteOAuthClient(ctx context.Context, req *pb.DeleteOAuthClientRequest) (*pb.DeleteOAuthClientResponse, error) {
+	if err := s.authService.DeleteOAuthClient(ctx, req.GetClientId()); err != nil {
+		return nil, err
+	}
+	return &pb.DeleteOAuthClientResponse{}, nil
+}
+
+func (s *AuthServer) IntrospectToken(ctx context.Context, req *pb.IntrospectTokenRequest) (*pb.IntrospectTokenResponse, error) {
+	introspection, err := s.authService.IntrospectToken(ctx, req.GetToken())
+	if err != nil {
+		return nil, err
+	}
+
+	if !introspection.Active {
+		return &pb.IntrospectTokenResponse{Active: false}, nil
+	}
+
+	return &pb.IntrospectTokenResponse{
+		Active:    true,
+		Subject:   introspection.Subject,
+		Username:  introspection.Username,
+		Roles:     introspection.Roles,
+		SessionId: introspection.SessionID,
+		TokenId:   introspection.TokenID,
+		IssuedAt:  timestamppb.New(introspection.IssuedAt),
+		ExpiresAt: timestamppb.New(introspection.ExpiresAt),
+		ActorId:   introspection.ActorID,
+		ClientId:  introspection.ClientID,
+		ApiKeyId:  introspection.APIKeyID,
+
+		Permissions: introspection.Permissions,
+	}, nil
+}
+
+func (s *AuthServer) CreateApiKey(ctx context.Context, req *pb.CreateApiKeyRequest) (*pb.CreateApiKeyResponse, error) {
+	spec := &service.APIKeySpec{
+		OwnerID: req.GetOwnerId(),
+		Name:    req.GetName(),
+		Roles:   req.GetRoles(),
+	}
+	if req.ExpiresAt != nil {
+		expiresAt := req.GetExpiresAt().AsTime()
+		spec.ExpiresAt = &expiresAt
+	}
+
+	created, err := s.authService.CreateAPIKey(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.CreateApiKeyResponse{
+		ApiKey: created.Key,
+		Key:    apiKeyToProtoApiKey(&created.APIKey),
+	}, nil
+}
+
+func (s *AuthServer) ListApiKeys(ctx context.Context, req *pb.ListApiKeysRequest) (*pb.ListApiKeysResponse, error) {
+	keys, err := s.authService.ListAPIKeys(ctx, req.GetOwnerId())
+	if err != nil {
+		return nil, err
+	}
+
+	pbKeys := make([]*pb.ApiKey, 0, len(keys))
+	for i := range keys {
+		pbKeys = append(pbKeys, apiKeyToProtoApiKey(&keys[i]))
+	}
+	return &pb.ListApiKeysResponse{Keys: pbKeys}, nil
+}
+
+func (s *AuthServer) RevokeApiKey(ctx context.Context, req *pb.RevokeApiKeyRequest) (*pb.RevokeApiKeyResponse, error) {
+	if err := s.authService.RevokeAPIKey(ctx, req.GetId()); err != nil {
+		return nil, err
+	}
+	return &pb.RevokeApiKeyResponse{}, nil
+}
+
+func (s *AuthServer) ExchangeApiKey(ctx context.Context, req *pb.ExchangeApiKeyRequest) (*pb.ExchangeApiKeyResponse, error) {
+	access, expiresAt, err := s.authService.ExchangeAPIKey(ctx, req.GetApiKey())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.ExchangeApiKeyResponse{
+		AccessToken: access,
+		ExpiresAt:   timestamppb.New(expiresAt),
+	}, nil
+}
+
+func (s *AuthServer) Impersonate(ctx context.Context, req *pb.ImpersonateRequest) (*pb.ImpersonateResponse, error) {
+	access, expiresAt, err := s.authService.Impersonate(ctx, req.GetTargetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.ImpersonateResponse{
+		AccessToken: access,
+		ExpiresAt:   timestamppb.New(expiresAt),
+	}, nil
+}
+
+func apiKeyToProtoApiKey(k *service.APIKey) *pb.ApiKey {
+	key := &pb.ApiKey{
+		Id:        k.ID,
+		Name:      k.Name,
+		Prefix:    k.Prefix,
+		OwnerId:   k.OwnerID,
+		Roles:     k.Roles,
+		CreatedAt: timestamppb.New(k.CreatedAt),
+	}
+	if k.LastUsedAt != nil {
+		key.LastUsedAt = timestamppb.New(*k.LastUsedAt)
+	}
+	if k.ExpiresAt != nil {
+		key.ExpiresAt = timestamppb.New(*k.ExpiresAt)
+	}
+	return key
+}
+
 func tokensToProtoTokens(t *service.Tokens) *pb.Tokens {
 	return &pb.Tokens{
 		AccessToken:           t.Access,
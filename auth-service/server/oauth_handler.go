@@ -0,0 +1,203 @@
+package server
+
+import (
+	"auth-service/service"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type oauthHandler struct {
+	authService service.AuthService
+}
+
+// NewOAuthHandler serves the OAuth2 authorization server endpoints that
+// third-party clients talk to directly over HTTP.
+func NewOAuthHandler(authService service.AuthService) http.Handler {
+	h := &oauthHandler{authService: authService}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", h.discovery)
+	mux.HandleFunc("GET /jwks", h.jwks)
+	mux.HandleFunc("GET /authorize", h.authorize)
+	mux.HandleFunc("POST /authorize", h.authorize)
+	mux.HandleFunc("POST /token", h.token)
+	return mux
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+func (h *oauthHandler) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.authService.OpenIDConfiguration())
+}
+
+func (h *oauthHandler) jwks(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.authService.GetPublicKeys(r.Context())
+	if err != nil {
+		http.Error(w, "failed to get keys", http.StatusInternalServerError)
+		return
+	}
+
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{Keys: make([]jwk, 0, len(keys))}
+	for _, key := range keys {
+		set.Keys = append(set.Keys, jwk(key))
+	}
+	writeJSON(w, http.StatusOK, set)
+}
+
+func (h *oauthHandler) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, &service.OAuthError{Code: "invalid_request", Description: "malformed request"})
+		return
+	}
+
+	req := &service.AuthorizeRequest{
+		ResponseType:        r.Form.Get("response_type"),
+		ClientID:            r.Form.Get("client_id"),
+		RedirectURI:         r.Form.Get("redirect_uri"),
+		Scope:               r.Form.Get("scope"),
+		State:               r.Form.Get("state"),
+		Nonce:               r.Form.Get("nonce"),
+		CodeChallenge:       r.Form.Get("code_challenge"),
+		CodeChallengeMethod: r.Form.Get("code_challenge_method"),
+	}
+
+	result, err := h.authService.Authorize(incomingContext(r), req)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	target, err := url.Parse(result.RedirectURI)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+	query := target.Query()
+	for key, values := range result.Params {
+		query[key] = values
+	}
+	target.RawQuery = query.Encode()
+
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func (h *oauthHandler) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, &service.OAuthError{Code: "invalid_request", Description: "malformed request"})
+		return
+	}
+
+	req := &service.TokenRequest{
+		GrantType:    r.PostForm.Get("grant_type"),
+		ClientID:     r.PostForm.Get("client_id"),
+		ClientSecret: r.PostForm.Get("client_secret"),
+		Code:         r.PostForm.Get("code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+		RefreshToken: r.PostForm.Get("refresh_token"),
+		Scope:        r.PostForm.Get("scope"),
+	}
+	// Credentials in the Authorization header are form encoded (RFC 6749
+	// section 2.3.1).
+	if id, secret, ok := r.BasicAuth(); ok {
+		req.ClientID, _ = url.QueryUnescape(id)
+		req.ClientSecret, _ = url.QueryUnescape(secret)
+	}
+
+	res, err := h.authService.IssueOAuthToken(incomingContext(r), req)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, res)
+}
+
+// incomingContext exposes the request the way the gRPC server would, so the
+// service can authenticate the caller and record client details. Clients
+// reach this endpoint directly, so the connection's address is their own and
+// forwarding headers they send are not to be believed.
+func incomingContext(r *http.Request) context.Context {
+	md := metadata.MD{}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		md.Set("authorization", auth)
+	}
+	if ua := r.UserAgent(); ua != "" {
+		md.Set("user-agent", ua)
+	}
+	ctx := metadata.NewIncomingContext(r.Context(), md)
+
+	if addr, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: net.TCPAddrFromAddrPort(addr)})
+	}
+	return ctx
+}
+
+func writeOAuthError(w http.ResponseWriter, err error) {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		switch status.Code(err) {
+		case codes.Unauthenticated:
+			oauthErr = &service.OAuthError{Code: "access_denied", Description: status.Convert(err).Message()}
+		case codes.ResourceExhausted:
+			w.Header().Set("Cache-Control", "no-store")
+			writeJSON(w, http.StatusTooManyRequests, map[string]string{
+				"error":             "invalid_client",
+				"error_description": status.Convert(err).Message(),
+			})
+			return
+		default:
+			log.Printf("OAuth request failed: %v", err)
+			w.Header().Set("Cache-Control", "no-store")
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+			return
+		}
+	}
+
+	code := http.StatusBadRequest
+	switch oauthErr.Code {
+	case "invalid_client":
+		code = http.StatusUnauthorized
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	case "access_denied":
+		code = http.StatusUnauthorized
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, code, map[string]string{
+		"error":             oauthErr.Code,
+		"error_description": oauthErr.Description,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("failed to write response: %v", err)
+	}
+}
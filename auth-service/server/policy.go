@@ -0,0 +1,23 @@
+package server
+
+import (
+	pb "auth-service/pb"
+	"authkit/serviceauth"
+)
+
+const (
+	gateway     = "gateway"
+	userService = "user-service"
+)
+
+// Policy lists which services may call each RPC of auth-service. user-service
+// validates tokens, ends sessions and throttles password checks on behalf of
+// its own callers.
+var Policy = serviceauth.Policy{
+	pb.AuthService_IntrospectToken_FullMethodName:       {gateway, userService},
+	pb.AuthService_RevokeAllSessions_FullMethodName:     {gateway, userService},
+	pb.AuthService_RevokeAccessTokens_FullMethodName:    {gateway, userService},
+	pb.AuthService_CheckPasswordGuard_FullMethodName:    {userService},
+	pb.AuthService_RecordPasswordFailure_FullMethodName: {userService},
+	"/auth.AuthService/*":                               {gateway},
+}
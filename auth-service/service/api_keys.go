@@ -0,0 +1,242 @@
+package service
+
+import (
+	"auth-service/dto"
+	"auth-service/models"
+	"auth-service/repository"
+	userpb "auth-service/user-pb"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	apiKeyPrefix        = "chk_"
+	apiKeyDisplayLength = len(apiKeyPrefix) + 8
+)
+
+// CreateAPIKey issues a key for the caller, or for ownerID when the caller is
+// an admin setting up a service account. The roles must be a subset of the
+// owner's; the raw key is returned once and only its hash is stored.
+func (s *authService) CreateAPIKey(ctx context.Context, spec *APIKeySpec) (*CreatedAPIKey, error) {
+	if spec.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "key name is required")
+	}
+	if spec.ExpiresAt != nil && !spec.ExpiresAt.After(time.Now()) {
+		return nil, status.Error(codes.InvalidArgument, "expiry must be in the future")
+	}
+
+	caller, err := s.authenticateInteractive(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ownerID := spec.OwnerID
+	if ownerID == "" {
+		ownerID = caller.Subject
+	}
+	if ownerID != caller.Subject && !caller.hasRole(adminRole) {
+		return nil, status.Error(codes.PermissionDenied, "not allowed to create API keys for another user")
+	}
+
+	userRes, err := s.userService.GetUserById(ctx, &userpb.GetUserByIdRequest{Id: ownerID})
+	if status.Code(err) == codes.NotFound {
+		return nil, status.Error(codes.NotFound, "user not found")
+	} else if err != nil {
+		log.Printf("failed to get user: %v", err)
+		return nil, status.Error(codes.Internal, "failed to create API key")
+	}
+
+	ownerRoles := extractRoleNames(userRes.GetUser().GetRoles())
+	for _, role := range spec.Roles {
+		if !slices.Contains(ownerRoles, role) {
+			return nil, status.Errorf(codes.InvalidArgument, "owner does not have role %q", role)
+		}
+	}
+
+	if s.config.MaxAPIKeysPerUser > 0 {
+		count, err := s.apiKeys.CountActiveAPIKeys(ctx, ownerID)
+		if err != nil {
+			log.Printf("failed to count API keys: %v", err)
+			return nil, status.Error(codes.Internal, "failed to create API key")
+		}
+		if count >= int64(s.config.MaxAPIKeysPerUser) {
+			return nil, status.Error(codes.ResourceExhausted, "too many API keys")
+		}
+	}
+
+	rawKey := newAPIKey()
+	saveDto := &dto.SaveAPIKey{
+		KeyHash:    hashOpaqueToken(rawKey),
+		Prefix:     rawKey[:apiKeyDisplayLength],
+		OwnerID:    ownerID,
+		Name:       spec.Name,
+		Roles:      spec.Roles,
+		CreatedBy:  caller.Subject,
+		Expiration: spec.ExpiresAt,
+	}
+	key, err := s.apiKeys.SaveAPIKey(ctx, saveDto)
+	if err != nil {
+		log.Printf("failed to save API key: %v", err)
+		return nil, status.Error(codes.Internal, "failed to create API key")
+	}
+
+	return &CreatedAPIKey{Key: rawKey, APIKey: apiKeyFromModel(key)}, nil
+}
+
+// ListAPIKeys returns the active keys of ownerID, or of the caller when empty.
+func (s *authService) ListAPIKeys(ctx context.Context, ownerID string) ([]APIKey, error) {
+	caller, err := s.authenticateInteractive(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if ownerID == "" {
+		ownerID = caller.Subject
+	}
+	if ownerID != caller.Subject && !caller.hasRole(adminRole) {
+		return nil, status.Error(codes.PermissionDenied, "not allowed to list API keys of another user")
+	}
+
+	keys, err := s.apiKeys.ListActiveAPIKeys(ctx, ownerID)
+	if err != nil {
+		log.Printf("failed to list API keys: %v", err)
+		return nil, status.Error(codes.Internal, "failed to list API keys")
+	}
+
+	res := make([]APIKey, 0, len(keys))
+	for i := range keys {
+		res = append(res, apiKeyFromModel(&keys[i]))
+	}
+	return res, nil
+}
+
+// RevokeAPIKey revokes one of the caller's keys, or any key for admins. Access
+// tokens already exchanged for the key stop working as well.
+func (s *authService) RevokeAPIKey(ctx context.Context, id string) error {
+	if id == "" {
+		return status.Error(codes.InvalidArgument, "key id is required")
+	}
+
+	caller, err := s.authenticateInteractive(ctx)
+	if err != nil {
+		return err
+	}
+
+	ownerID := caller.Subject
+	if caller.hasRole(adminRole) {
+		ownerID = ""
+	}
+
+	err = s.apiKeys.RevokeAPIKey(ctx, id, ownerID)
+	if errors.Is(err, repository.ErrEntityNotFound) {
+		return status.Error(codes.NotFound, "API key not found")
+	} else if err != nil {
+		log.Printf("failed to revoke API key: %v", err)
+		return status.Error(codes.Internal, "failed to revoke API key")
+	}
+	return nil
+}
+
+// ExchangeAPIKey trades a key for a short-lived access token. The token carries
+// the key's roles that the owner still holds, so demoting the owner also
+// narrows what their keys can do.
+func (s *authService) ExchangeAPIKey(ctx context.Context, rawKey string) (string, time.Time, error) {
+	if !strings.HasPrefix(rawKey, apiKeyPrefix) {
+		return "", time.Time{}, status.Error(codes.Unauthenticated, "invalid API key")
+	}
+
+	key, err := s.apiKeys.GetAPIKeyByHash(ctx, hashOpaqueToken(rawKey))
+	if errors.Is(err, repository.ErrEntityNotFound) {
+		return "", time.Time{}, status.Error(codes.Unauthenticated, "invalid API key")
+	} else if err != nil {
+		log.Printf("failed to get API key: %v", err)
+		return "", time.Time{}, status.Error(codes.Internal, "failed to exchange API key")
+	}
+	if !apiKeyActive(key) {
+		return "", time.Time{}, status.Error(codes.Unauthenticated, "invalid API key")
+	}
+
+	userRes, err := s.userService.GetUserById(ctx, &userpb.GetUserByIdRequest{Id: key.OwnerID})
+	if status.Code(err) == codes.NotFound {
+		return "", time.Time{}, status.Error(codes.Unauthenticated, "invalid API key")
+	} else if err != nil {
+		log.Printf("failed to get user: %v", err)
+		return "", time.Time{}, status.Error(codes.Internal, "failed to exchange API key")
+	}
+	user := userRes.GetUser()
+
+	ownerRoles := extractRoleNames(user.GetRoles())
+	var roles []string
+	for _, role := range strings.Fields(key.Roles) {
+		if slices.Contains(ownerRoles, role) {
+			roles = append(roles, role)
+		}
+	}
+
+	claims := &claims{
+		userId:   user.Id,
+		username: user.Username,
+		roles:    roles,
+		apiKeyId: key.ID,
+
+		permissions: permissionsForRoles(user.GetRoles(), roles),
+	}
+	access, accessExp, err := issueJwtToken(claims, s.config.APIKeyAccessTTL, s.keyring.SigningKey())
+	if err != nil {
+		log.Printf("failed to sign access token: %v", err)
+		return "", time.Time{}, status.Error(codes.Internal, "failed to exchange API key")
+	}
+
+	if err := s.apiKeys.TouchAPIKey(ctx, key.ID); err != nil {
+		log.Printf("failed to record API key use: %v", err)
+	}
+
+	return access, accessExp, nil
+}
+
+// isAPIKeyRevoked reports whether the key an access token was exchanged for
+// has since been revoked, expired or deleted.
+func (s *authService) isAPIKeyRevoked(ctx context.Context, id string) (bool, error) {
+	key, err := s.apiKeys.GetAPIKey(ctx, id)
+	if errors.Is(err, repository.ErrEntityNotFound) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	return !apiKeyActive(key), nil
+}
+
+func apiKeyActive(key *models.APIKey) bool {
+	if key.RevokedAt != nil {
+		return false
+	}
+	return key.ExpiresAt == nil || time.Now().Before(*key.ExpiresAt)
+}
+
+func apiKeyFromModel(key *models.APIKey) APIKey {
+	return APIKey{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		OwnerID:    key.OwnerID,
+		Roles:      strings.Fields(key.Roles),
+		CreatedAt:  key.CreatedAt,
+		LastUsedAt: key.LastUsedAt,
+		ExpiresAt:  key.ExpiresAt,
+	}
+}
+
+func newAPIKey() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return apiKeyPrefix + hex.EncodeToString(b)
+}
@@ -3,72 +3,199 @@ package service
 import (
 	"auth-service/config"
 	"auth-service/dto"
+	"auth-service/models"
+	"auth-service/notify"
 	"auth-service/repository"
 	userpb "auth-service/user-pb"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"log"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+const (
+	adminRole               = "ADMIN"
+	securityEventTokenReuse = "refresh_token_reuse"
+
+	// accessTokenType is the typ header of access tokens, per RFC 9068, so
+	// that verifiers using the published keys can tell them from ID tokens.
+	accessTokenType = "at+jwt"
+)
+
+var errInactiveToken = errors.New("access token is not active")
+
+func init() {
+	// Tokens record when they were issued to the microsecond so that a
+	// revocation denies exactly the tokens issued up to it.
+	jwt.TimePrecision = time.Microsecond
+}
+
 type AuthService interface {
-	Login(ctx context.Context, username, rawPassword string) (*Tokens, error)
+	Login(ctx context.Context, username, rawPassword string, rememberMe bool) (*LoginResult, error)
+	VerifySecondFactor(ctx context.Context, challengeToken, code string) (*Tokens, error)
+	BeginTotpEnrollment(ctx context.Context) (*TotpEnrollment, error)
+	ConfirmTotpEnrollment(ctx context.Context, code string) ([]string, error)
+	DisableTotp(ctx context.Context, code string) error
 	RotateRefreshToken(ctx context.Context, refreshToken string) (*Tokens, error)
+	Logout(ctx context.Context, refreshToken string) error
+	RevokeSession(ctx context.Context, sessionID string) error
+	RevokeAllSessions(ctx context.Context, userID string, keepCurrent bool) (int64, error)
+	ListSessions(ctx context.Context) ([]Session, string, error)
+	GetPublicKeys(ctx context.Context) ([]JsonWebKey, error)
+	IntrospectToken(ctx context.Context, token string) (*Introspection, error)
+	RevokeAccessTokens(ctx context.Context, userID string) error
+	UnlockAccount(ctx context.Context, username string) error
+	CheckPasswordGuard(ctx context.Context, username string) error
+	RecordPasswordFailure(ctx context.Context, username string) error
+	RequestPasswordReset(ctx context.Context, username string) error
+	ConfirmPasswordReset(ctx context.Context, token, newPassword string) error
+	BeginFederatedLogin(ctx context.Context, provider string, link, rememberMe bool) (*FederatedLoginRedirect, error)
+	CompleteFederatedLogin(ctx context.Context, state, code string) (*Tokens, error)
+	RegisterOAuthClient(ctx context.Context, spec *OAuthClientSpec) (*OAuthClientRegistration, error)
+	DeleteOAuthClient(ctx context.Context, clientID string) error
+	Authorize(ctx context.Context, req *AuthorizeRequest) (*AuthorizeResult, error)
+	IssueOAuthToken(ctx context.Context, req *TokenRequest) (*TokenResponse, error)
+	OpenIDConfiguration() *OpenIDConfiguration
+	CreateAPIKey(ctx context.Context, spec *APIKeySpec) (*CreatedAPIKey, error)
+	ListAPIKeys(ctx context.Context, ownerID string) ([]APIKey, error)
+	RevokeAPIKey(ctx context.Context, id string) error
+	ExchangeAPIKey(ctx context.Context, key string) (string, time.Time, error)
+	Impersonate(ctx context.Context, targetUserID string) (string, time.Time, error)
 }
 
 type authService struct {
-	repository  repository.AuthRepository
-	userService userpb.UserServiceClient
-	config      *config.Config
+	repository     repository.AuthRepository
+	denylist       repository.DenylistRepository
+	loginGuard     *LoginGuard
+	twoFactor      repository.TwoFactorRepository
+	passwordResets repository.PasswordResetRepository
+	notifier       notify.Notifier
+	federation     repository.FederationRepository
+	providers      FederatedProviders
+	oauth          repository.OAuthRepository
+	apiKeys        repository.APIKeyRepository
+	userService    userpb.UserServiceClient
+	config         *config.Config
+	keyring        *Keyring
 }
 
-func NewAuthService(repository repository.AuthRepository, userService userpb.UserServiceClient, config *config.Config) AuthService {
+func NewAuthService(repository repository.AuthRepository, denylist repository.DenylistRepository, loginGuard *LoginGuard, twoFactor repository.TwoFactorRepository, passwordResets repository.PasswordResetRepository, notifier notify.Notifier, federation repository.FederationRepository, providers FederatedProviders, oauth repository.OAuthRepository, apiKeys repository.APIKeyRepository, userService userpb.UserServiceClient, config *config.Config, keyring *Keyring) AuthService {
 	return &authService{
-		repository:  repository,
-		userService: userService,
-		config:      config,
+		repository:     repository,
+		denylist:       denylist,
+		loginGuard:     loginGuard,
+		twoFactor:      twoFactor,
+		passwordResets: passwordResets,
+		notifier:       notifier,
+		federation:     federation,
+		providers:      providers,
+		oauth:          oauth,
+		apiKeys:        apiKeys,
+		userService:    userService,
+		config:         config,
+		keyring:        keyring,
 	}
 }
 
-func (s *authService) Login(ctx context.Context, username, rawPassword string) (*Tokens, error) {
-	userReq := &userpb.GetCredentialsRequest{Username: username}
-	pbRes, err := s.userService.GetCredentials(ctx, userReq)
-	if err != nil {
+func (s *authService) Login(ctx context.Context, username, rawPassword string, rememberMe bool) (*LoginResult, error) {
+	client := clientInfoFromContext(ctx, s.config.TrustedProxies)
+	if err := s.loginGuard.Check(ctx, username, client.ip); err != nil {
 		return nil, err
 	}
 
-	if err = comparePassword(pbRes.GetHashedPassword(), rawPassword); err != nil {
+	userReq := &userpb.VerifyPasswordRequest{Username: username, Password: rawPassword}
+	pbRes, err := s.userService.VerifyPassword(ctx, userReq)
+	switch status.Code(err) {
+	case codes.OK:
+	case codes.NotFound, codes.Unauthenticated:
+		s.loginGuard.RecordFailure(ctx, username, client.ip)
 		return nil, err
+	default:
+		log.Printf("failed to verify password: %v", err)
+		return nil, status.Error(codes.Internal, "could not login")
 	}
 
 	user := pbRes.GetUser()
+	twoFactor, err := s.twoFactor.GetTwoFactor(ctx, user.Id)
+	if err != nil && !errors.Is(err, repository.ErrEntityNotFound) {
+		log.Printf("failed to get two-factor settings: %v", err)
+		return nil, status.Error(codes.Internal, "could not login")
+	}
+	if twoFactor != nil && twoFactor.ConfirmedAt != nil {
+		challenge, err := s.issueLoginChallenge(ctx, user.Id, user.Username, rememberMe)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{Challenge: challenge}, nil
+	}
+	s.loginGuard.RecordSuccess(ctx, username)
+
+	tokens, err := s.startSession(ctx, user, client, sessionGrant{rememberMe: rememberMe})
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginResult{Tokens: tokens}, nil
+}
+
+// startSession issues the first tokens of a new session (refresh token family)
+// for a fully authenticated user.
+func (s *authService) startSession(ctx context.Context, user *userpb.User, client clientInfo, grant sessionGrant) (*Tokens, error) {
+	familyID := strings.ReplaceAll(uuid.NewString(), "-", "")
+	startedAt := time.Now()
 	claims := &claims{
-		userId:   user.Id,
-		username: user.Username,
-		roles:    extractRoleNames(user.Roles),
+		userId:    user.Id,
+		username:  user.Username,
+		roles:     extractRoleNames(user.Roles),
+		sessionId: familyID,
 	}
+	if grant.clientID != "" {
+		claims.roles = s.rolesForScope(grant.scope, claims.roles)
+		claims.scope = grant.scope
+		claims.clientId = grant.clientID
+	}
+	claims.permissions = permissionsForRoles(user.Roles, claims.roles)
 
-	tokens, err := s.generateTokens(claims)
+	tokens, err := s.generateTokens(claims, s.refreshTTL(startedAt, grant.rememberMe))
 	if err != nil {
 		return nil, err
 	}
 
-	if err = s.saveRefreshToken(ctx, tokens.Refresh, user.Id, tokens.RefreshExp); err != nil {
+	saveDto := &dto.SaveRefreshToken{
+		TokenHash:        s.hashRefreshToken(tokens.Refresh),
+		UserID:           user.Id,
+		FamilyID:         familyID,
+		SessionStartedAt: startedAt,
+		ClientIP:         client.ip,
+		UserAgent:        client.userAgent,
+		RememberMe:       grant.rememberMe,
+		ClientID:         grant.clientID,
+		Scope:            grant.scope,
+		Expiration:       tokens.RefreshExp,
+	}
+	if err = s.saveRefreshToken(ctx, saveDto); err != nil {
 		return nil, err
 	}
 
+	s.enforceSessionLimit(ctx, user.Id, familyID)
+
 	return tokens, nil
 }
 
 func (s *authService) RotateRefreshToken(ctx context.Context, oldToken string) (*Tokens, error) {
-	token, err := s.repository.GetRefreshToken(ctx, oldToken)
+	oldTokenHash := s.hashRefreshToken(oldToken)
+	token, err := s.repository.GetRefreshToken(ctx, oldTokenHash)
 	if errors.Is(err, repository.ErrEntityNotFound) {
 		return nil, status.Error(codes.Unauthenticated, "refresh token not found")
 	} else if err != nil {
@@ -76,10 +203,34 @@ func (s *authService) RotateRefreshToken(ctx context.Context, oldToken string) (
 		return nil, status.Error(codes.Unauthenticated, "failed to refresh token")
 	}
 
+	// Tokens issued to OAuth clients are refreshed through the token endpoint.
+	if token.ClientID != "" {
+		return nil, status.Error(codes.Unauthenticated, "refresh token not found")
+	}
+
+	return s.rotateSession(ctx, token, oldTokenHash)
+}
+
+// rotateSession exchanges the refresh token for a new pair, reading the user's
+// current roles so that role changes take effect on the next refresh.
+func (s *authService) rotateSession(ctx context.Context, token *models.RefreshToken, oldTokenHash string) (*Tokens, error) {
+	if token.RevokedAt != nil {
+		return nil, status.Error(codes.Unauthenticated, "refresh token revoked")
+	}
+
+	if token.RotatedAt != nil {
+		return nil, s.handleTokenReuse(ctx, token.UserID, token.FamilyID)
+	}
+
 	if time.Now().After(token.ExpiresAt) {
 		return nil, status.Error(codes.Unauthenticated, "refresh token expired")
 	}
 
+	refreshTTL := s.refreshTTL(token.SessionStartedAt, token.RememberMe)
+	if refreshTTL <= 0 {
+		return nil, status.Error(codes.Unauthenticated, "session expired")
+	}
+
 	userReq := &userpb.GetUserByIdRequest{Id: token.UserID}
 	userRes, err := s.userService.GetUserById(ctx, userReq)
 	if err != nil {
@@ -88,24 +239,39 @@ func (s *authService) RotateRefreshToken(ctx context.Context, oldToken string) (
 	}
 
 	claims := &claims{
-		userId:   token.UserID,
-		username: userRes.User.Username,
-		roles:    extractRoleNames(userRes.User.Roles),
+		userId:    token.UserID,
+		username:  userRes.User.Username,
+		roles:     extractRoleNames(userRes.User.Roles),
+		sessionId: token.FamilyID,
 	}
-	newTokens, err := s.generateTokens(claims)
+	if token.ClientID != "" {
+		claims.roles = s.rolesForScope(token.Scope, claims.roles)
+		claims.scope = token.Scope
+		claims.clientId = token.ClientID
+	}
+	claims.permissions = permissionsForRoles(userRes.User.Roles, claims.roles)
+	newTokens, err := s.generateTokens(claims, refreshTTL)
 	if err != nil {
 		return nil, err
 	}
 
+	client := clientInfoFromContext(ctx, s.config.TrustedProxies)
 	rotateDto := &dto.SaveRefreshToken{
-		RefreshToken: newTokens.Refresh,
-		UserID:       token.UserID,
-		Expiration:   newTokens.RefreshExp,
+		TokenHash:        s.hashRefreshToken(newTokens.Refresh),
+		UserID:           token.UserID,
+		FamilyID:         token.FamilyID,
+		SessionStartedAt: token.SessionStartedAt,
+		ClientIP:         client.ip,
+		UserAgent:        client.userAgent,
+		RememberMe:       token.RememberMe,
+		ClientID:         token.ClientID,
+		Scope:            token.Scope,
+		Expiration:       newTokens.RefreshExp,
 	}
-	err = s.repository.RotateRefreshToken(ctx, oldToken, rotateDto)
+	err = s.repository.RotateRefreshToken(ctx, oldTokenHash, rotateDto)
 
-	if errors.Is(err, repository.ErrEntityNotFound) {
-		return nil, status.Error(codes.Unauthenticated, "refresh token not found")
+	if errors.Is(err, repository.ErrTokenReused) {
+		return nil, s.handleTokenReuse(ctx, token.UserID, token.FamilyID)
 	} else if err != nil {
 		log.Printf("failed to rotate refresh token: %v", err)
 		return nil, status.Error(codes.Unauthenticated, "failed to refresh token")
@@ -114,16 +280,353 @@ func (s *authService) RotateRefreshToken(ctx context.Context, oldToken string) (
 	return newTokens, nil
 }
 
-func (s *authService) generateTokens(c *claims) (*Tokens, error) {
-	cfg := *s.config
+func (s *authService) Logout(ctx context.Context, refreshToken string) error {
+	token, err := s.repository.GetRefreshToken(ctx, s.hashRefreshToken(refreshToken))
+	if errors.Is(err, repository.ErrEntityNotFound) {
+		return status.Error(codes.Unauthenticated, "refresh token not found")
+	} else if err != nil {
+		log.Printf("failed to get refresh token: %v", err)
+		return status.Error(codes.Internal, "failed to logout")
+	}
+
+	filter := &dto.RevokeRefreshTokens{FamilyID: token.FamilyID}
+	if _, err := s.repository.RevokeRefreshTokens(ctx, filter); err != nil {
+		log.Printf("failed to revoke refresh token family: %v", err)
+		return status.Error(codes.Internal, "failed to logout")
+	}
+
+	if access, ok := bearerTokenFromContext(ctx); ok {
+		if claims, err := parseJwtToken(access, s.keyring); err == nil && claims.ID != "" {
+			if err := s.denylist.DenyTokenID(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+				log.Printf("failed to deny access token: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *authService) RevokeSession(ctx context.Context, sessionID string) error {
+	if sessionID == "" {
+		return status.Error(codes.InvalidArgument, "session id is required")
+	}
+
+	caller, err := s.authenticateInteractive(ctx)
+	if err != nil {
+		return err
+	}
+
+	filter := &dto.RevokeRefreshTokens{FamilyID: sessionID}
+	if !caller.hasRole(adminRole) {
+		filter.UserID = caller.Subject
+	}
+
+	revoked, err := s.repository.RevokeRefreshTokens(ctx, filter)
+	if err != nil {
+		log.Printf("failed to revoke session: %v", err)
+		return status.Error(codes.Internal, "failed to revoke session")
+	}
+
+	if revoked == 0 {
+		return status.Error(codes.NotFound, "session not found")
+	}
+
+	return nil
+}
+
+// RevokeAllSessions signs a user out everywhere. Users may do this for
+// themselves; revoking someone else's sessions requires the admin role. With
+// keepCurrent, the session the caller's token belongs to is spared.
+func (s *authService) RevokeAllSessions(ctx context.Context, userID string, keepCurrent bool) (int64, error) {
+	if userID == "" {
+		return 0, status.Error(codes.InvalidArgument, "user id is required")
+	}
+
+	caller, err := s.authenticateInteractive(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if caller.Subject != userID && !caller.hasRole(adminRole) {
+		return 0, status.Error(codes.PermissionDenied, "not allowed to revoke sessions of another user")
+	}
+
+	filter := &dto.RevokeRefreshTokens{UserID: userID}
+	if keepCurrent && caller.SessionID != "" {
+		filter.ExceptFamilyIDs = []string{caller.SessionID}
+	}
+
+	revoked, err := s.repository.RevokeRefreshTokens(ctx, filter)
+	if err != nil {
+		log.Printf("failed to revoke sessions: %v", err)
+		return 0, status.Error(codes.Internal, "failed to revoke sessions")
+	}
+
+	return revoked, nil
+}
 
-	access, accessExp, err := issueJwtToken(c, cfg.AccessTTL, cfg.AccessSecret)
+// ListSessions returns the caller's live sessions along with the ID of the
+// session the caller is currently using.
+func (s *authService) ListSessions(ctx context.Context) ([]Session, string, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	tokens, err := s.repository.ListActiveRefreshTokens(ctx, caller.Subject)
+	if err != nil {
+		log.Printf("failed to list refresh tokens: %v", err)
+		return nil, "", status.Error(codes.Internal, "failed to list sessions")
+	}
+
+	sessions := make([]Session, 0, len(tokens))
+	for _, t := range tokens {
+		sessions = append(sessions, Session{
+			ID:         t.FamilyID,
+			CreatedAt:  t.SessionStartedAt,
+			LastUsedAt: t.CreatedAt,
+			ExpiresAt:  t.ExpiresAt,
+			ClientIP:   t.ClientIP,
+			UserAgent:  t.UserAgent,
+		})
+	}
+
+	return sessions, caller.SessionID, nil
+}
+
+func (s *authService) GetPublicKeys(ctx context.Context) ([]JsonWebKey, error) {
+	return s.keyring.PublicKeys(), nil
+}
+
+// RevokeAccessTokens invalidates every access token issued to the user so far,
+// e.g. after the account is deleted or loses a role. Sessions stay alive, so
+// clients pick up the user's current roles on their next refresh.
+//
+// Calls carrying no access token are accepted from the services in
+// TokenRevokers, such as user-service expiring role grants in the background.
+func (s *authService) RevokeAccessTokens(ctx context.Context, userID string) error {
+	if userID == "" {
+		return status.Error(codes.InvalidArgument, "user id is required")
+	}
+
+	if _, hasToken := bearerTokenFromContext(ctx); !hasToken && isTrustedService(ctx, s.config.TokenRevokers) {
+		return s.denyAccessTokens(ctx, userID)
+	}
+
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return err
+	}
+
+	if caller.Subject != userID && !caller.hasRole(adminRole) {
+		return status.Error(codes.PermissionDenied, "not allowed to revoke tokens of another user")
+	}
+
+	return s.denyAccessTokens(ctx, userID)
+}
+
+func (s *authService) denyAccessTokens(ctx context.Context, userID string) error {
+	now := time.Now()
+	if err := s.denylist.DenyUser(ctx, userID, now, now.Add(s.config.AccessTTL)); err != nil {
+		log.Printf("failed to deny access tokens: %v", err)
+		return status.Error(codes.Internal, "failed to revoke access tokens")
+	}
+
+	return nil
+}
+
+func (s *authService) UnlockAccount(ctx context.Context, username string) error {
+	if username == "" {
+		return status.Error(codes.InvalidArgument, "username is required")
+	}
+
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !caller.hasRole(adminRole) {
+		return status.Error(codes.PermissionDenied, "only admins can unlock accounts")
+	}
+
+	if err := s.loginGuard.Unlock(ctx, username); err != nil {
+		log.Printf("failed to unlock account: %v", err)
+		return status.Error(codes.Internal, "failed to unlock account")
+	}
+
+	return nil
+}
+
+// CheckPasswordGuard rejects a password check made outside of a login, such as
+// on a password change, with ResourceExhausted while the account is locked
+// out. Wrong passwords entered there count towards the same lockout as failed
+// logins, so a stolen session cannot be used to guess the password faster.
+func (s *authService) CheckPasswordGuard(ctx context.Context, username string) error {
+	if username == "" {
+		return status.Error(codes.InvalidArgument, "username is required")
+	}
+	return s.loginGuard.Check(ctx, username, "")
+}
+
+// RecordPasswordFailure counts a wrong password entered outside of a login.
+func (s *authService) RecordPasswordFailure(ctx context.Context, username string) error {
+	if username == "" {
+		return status.Error(codes.InvalidArgument, "username is required")
+	}
+	s.loginGuard.RecordFailure(ctx, username, "")
+	return nil
+}
+
+// IntrospectToken is the authoritative check for access tokens presented to
+// other services. Invalid tokens are reported as inactive rather than as errors.
+func (s *authService) IntrospectToken(ctx context.Context, token string) (*Introspection, error) {
+	claims, err := s.verifyAccessToken(ctx, token)
+	if errors.Is(err, errInactiveToken) {
+		return &Introspection{Active: false}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	introspection := &Introspection{
+		Active:    true,
+		Subject:   claims.Subject,
+		Username:  claims.Username,
+		ClientID:  claims.ClientID,
+		APIKeyID:  claims.APIKeyID,
+		Roles:     claims.Roles,
+		SessionID: claims.SessionID,
+		TokenID:   claims.ID,
+		IssuedAt:  claims.IssuedAt.Time,
+		ExpiresAt: claims.ExpiresAt.Time,
+
+		Permissions: claims.Permissions,
+	}
+	if claims.Actor != nil {
+		introspection.ActorID = claims.Actor.Subject
+	}
+
+	return introspection, nil
+}
+
+// authenticate validates the access token sent by the caller and returns its
+// claims.
+func (s *authService) authenticate(ctx context.Context) (*jwtClaims, error) {
+	token, ok := bearerTokenFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing access token")
+	}
+
+	claims, err := s.verifyAccessToken(ctx, token)
+	if errors.Is(err, errInactiveToken) {
+		return nil, status.Error(codes.Unauthenticated, "invalid access token")
+	} else if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// authenticateInteractive is authenticate for actions that change how the
+// user signs in or what holds their credentials. Those take the user's own
+// session: OAuth client tokens, API key tokens and impersonation tokens are
+// turned away.
+func (s *authService) authenticateInteractive(ctx context.Context) (*jwtClaims, error) {
+	claims, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if claims.ClientID != "" || claims.APIKeyID != "" || claims.Actor != nil {
+		return nil, status.Error(codes.PermissionDenied, "this action requires the user's own session")
+	}
+	return claims, nil
+}
+
+// verifyAccessToken checks the signature and expiry of an access token, that
+// it has not been denylisted and that the session it was issued for has not
+// been revoked since.
+func (s *authService) verifyAccessToken(ctx context.Context, token string) (*jwtClaims, error) {
+	claims, err := parseJwtToken(token, s.keyring)
+	if err != nil {
+		return nil, errInactiveToken
+	}
+
+	denied, err := s.denylist.IsDenied(ctx, claims.ID, claims.Subject, claims.IssuedAt.Time)
+	if err != nil {
+		log.Printf("failed to check access token denylist: %v", err)
+		return nil, status.Error(codes.Internal, "failed to verify access token")
+	}
+	if denied {
+		return nil, errInactiveToken
+	}
+
+	if claims.SessionID != "" {
+		revoked, err := s.repository.IsFamilyRevoked(ctx, claims.SessionID)
+		if err != nil {
+			log.Printf("failed to check session revocation: %v", err)
+			return nil, status.Error(codes.Internal, "failed to verify access token")
+		}
+		if revoked {
+			return nil, errInactiveToken
+		}
+	}
+
+	if claims.APIKeyID != "" {
+		revoked, err := s.isAPIKeyRevoked(ctx, claims.APIKeyID)
+		if err != nil {
+			log.Printf("failed to check API key revocation: %v", err)
+			return nil, status.Error(codes.Internal, "failed to verify access token")
+		}
+		if revoked {
+			return nil, errInactiveToken
+		}
+	}
+
+	// Impersonation tokens are only honoured while their use can be audited.
+	if claims.Actor != nil {
+		if err := s.recordImpersonationUse(ctx, claims); err != nil {
+			log.Printf("failed to record impersonation use: %v", err)
+			return nil, status.Error(codes.Internal, "failed to verify access token")
+		}
+	}
+
+	return claims, nil
+}
+
+// handleTokenReuse revokes every refresh token descending from the same login
+// once an already rotated token is presented again, since either the legitimate
+// client or an attacker is holding a stolen copy and we cannot tell which.
+func (s *authService) handleTokenReuse(ctx context.Context, userID, familyID string) error {
+	filter := &dto.RevokeRefreshTokens{FamilyID: familyID}
+	if _, err := s.repository.RevokeRefreshTokens(ctx, filter); err != nil {
+		log.Printf("failed to revoke refresh token family %s: %v", familyID, err)
+	}
+
+	event := &dto.SaveSecurityEvent{
+		Type:     securityEventTokenReuse,
+		UserID:   userID,
+		FamilyID: familyID,
+		Details:  "rotated refresh token presented again; token family revoked",
+	}
+	if err := s.repository.SaveSecurityEvent(ctx, event); err != nil {
+		log.Printf("failed to record security event: %v", err)
+	}
+
+	log.Printf("refresh token reuse detected for user %s, family %s revoked", userID, familyID)
+	return status.Error(codes.Unauthenticated, "refresh token reuse detected")
+}
+
+// generateTokens issues an access and a refresh token. The access token never
+// outlives the refresh token, so it cannot extend a session past its end.
+func (s *authService) generateTokens(c *claims, refreshTTL time.Duration) (*Tokens, error) {
+	accessTTL := min(s.config.AccessTTL, refreshTTL)
+
+	access, accessExp, err := issueJwtToken(c, accessTTL, s.keyring.SigningKey())
 	if err != nil {
 		log.Printf("failed to sign access token: %v", err)
 		return nil, status.Error(codes.Internal, "failed to login")
 	}
 
-	refresh, refreshExp := issueOpaqueToken(cfg.RefreshTTL)
+	refresh, refreshExp := issueOpaqueToken(refreshTTL)
 
 	return &Tokens{
 		Access:     access,
@@ -133,13 +636,7 @@ func (s *authService) generateTokens(c *claims) (*Tokens, error) {
 	}, nil
 }
 
-func (s *authService) saveRefreshToken(ctx context.Context, token, userID string, expiration time.Time) error {
-	saveDto := &dto.SaveRefreshToken{
-		RefreshToken: token,
-		UserID:       userID,
-		Expiration:   expiration,
-	}
-
+func (s *authService) saveRefreshToken(ctx context.Context, saveDto *dto.SaveRefreshToken) error {
 	if err := s.repository.SaveRefreshToken(ctx, saveDto); err != nil {
 		log.Printf("failed to save refresh token: %v", err)
 		return status.Error(codes.Internal, "could not issue refresh token")
@@ -148,25 +645,25 @@ func (s *authService) saveRefreshToken(ctx context.Context, token, userID string
 	return nil
 }
 
+// hashRefreshToken derives the lookup key stored in place of a refresh token,
+// so a copy of the database alone does not yield usable tokens.
+func (s *authService) hashRefreshToken(token string) string {
+	return HashRefreshToken(s.config.RefreshSecret, token)
+}
+
+// HashRefreshToken is an HMAC-SHA256 of token keyed with secret, hex encoded.
+func HashRefreshToken(secret []byte, token string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
 func issueOpaqueToken(TTL time.Duration) (string, time.Time) {
 	token := strings.ReplaceAll(uuid.NewString(), "-", "")
 	expiration := time.Now().Add(TTL)
 	return token, expiration
 }
 
-func comparePassword(hashedPassword, password string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
-
-	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-		return status.Error(codes.Unauthenticated, "wrong password")
-	} else if err != nil {
-		log.Printf("error hashing password: %v", err)
-		return status.Error(codes.Internal, "could not login")
-	}
-
-	return nil
-}
-
 func extractRoleNames(roles []*userpb.Role) []string {
 	names := make([]string, 0, len(roles))
 	for _, role := range roles {
@@ -175,19 +672,74 @@ func extractRoleNames(roles []*userpb.Role) []string {
 	return names
 }
 
-func issueJwtToken(c *claims, TTL time.Duration, secret []byte) (string, time.Time, error) {
+// permissionsForRoles collects the permissions granted by those of the user's
+// roles that made it into the token.
+func permissionsForRoles(roles []*userpb.Role, names []string) []string {
+	var permissions []string
+	for _, role := range roles {
+		if !slices.Contains(names, role.Name) {
+			continue
+		}
+		for _, permission := range role.Permissions {
+			if !slices.Contains(permissions, permission) {
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+	return permissions
+}
+
+func issueJwtToken(c *claims, TTL time.Duration, key config.SigningKey) (string, time.Time, error) {
 	now := time.Now()
 	exp := now.Add(TTL)
 	claims := jwtClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        strings.ReplaceAll(uuid.NewString(), "-", ""),
 			Subject:   c.userId,
 			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(exp),
 		},
-		Username: c.username,
-		Roles:    c.roles,
+		Username:  c.username,
+		Roles:     c.roles,
+		SessionID: c.sessionId,
+		Scope:     c.scope,
+		ClientID:  c.clientId,
+		APIKeyID:  c.apiKeyId,
+		Actor:     c.actor,
+
+		Permissions: c.permissions,
 	}
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	s, err := t.SignedString(secret)
+	t := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	t.Header["kid"] = key.ID
+	t.Header["typ"] = accessTokenType
+	s, err := t.SignedString(key.Key)
 	return s, exp, err
 }
+
+func parseJwtToken(token string, keyring *Keyring) (*jwtClaims, error) {
+	claims := &jwtClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := keyring.VerificationKey(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		if key.Algorithm != t.Method.Alg() {
+			return nil, fmt.Errorf("signing key %q does not use %s", kid, t.Method.Alg())
+		}
+		return key.Public(), nil
+	}, jwt.WithValidMethods([]string{config.AlgorithmEdDSA, config.AlgorithmRS256}), jwt.WithExpirationRequired(), jwt.WithIssuedAt())
+	if err != nil {
+		return nil, err
+	}
+	if claims.IssuedAt == nil {
+		return nil, errors.New("access token has no issued at claim")
+	}
+	// ID tokens are signed with the same keys but always name the client
+	// they were issued to, which access tokens never do. Checking the
+	// audience rather than typ keeps tokens issued before typ was set valid.
+	if len(claims.Audience) > 0 {
+		return nil, errors.New("token is not an access token")
+	}
+	return claims, nil
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"authkit/serviceauth"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRevokeSessionsRequireUserSession(t *testing.T) {
+	s := newOAuthTestService(t)
+
+	clientToken := issueTestAccessToken(t, s, &claims{userId: "alice", clientId: "client-1", scope: "openid"})
+	ctx := withBearer(context.Background(), clientToken)
+	if _, err := s.RevokeAllSessions(ctx, "alice", false); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("RevokeAllSessions with a client token = %v, want PermissionDenied", err)
+	}
+	if err := s.RevokeSession(ctx, "session"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("RevokeSession with a client token = %v, want PermissionDenied", err)
+	}
+
+	userToken := issueTestAccessToken(t, s, &claims{userId: "alice", username: "alice", sessionId: "session"})
+	ctx = withBearer(context.Background(), userToken)
+	if _, err := s.RevokeAllSessions(ctx, "alice", true); err != nil {
+		t.Errorf("RevokeAllSessions from the user's session: %v", err)
+	}
+}
+
+func TestRevokeAccessTokensFromTrustedService(t *testing.T) {
+	s := newOAuthTestService(t)
+	s.config.TokenRevokers = []string{"user-service"}
+	denylist := s.denylist.(*fakeDenylistRepository)
+
+	ctx := serviceauth.NewContext(context.Background(), serviceauth.Identity{Service: "gateway", Mode: serviceauth.ModeToken})
+	if err := s.RevokeAccessTokens(ctx, "alice"); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("RevokeAccessTokens from an untrusted service = %v, want Unauthenticated", err)
+	}
+	if _, ok := denylist.deniedUsers["alice"]; ok {
+		t.Fatal("untrusted service revoked access tokens")
+	}
+
+	ctx = serviceauth.NewContext(context.Background(), serviceauth.Identity{Service: "user-service", Mode: serviceauth.ModeToken})
+	if err := s.RevokeAccessTokens(ctx, "alice"); err != nil {
+		t.Fatalf("RevokeAccessTokens from user-service: %v", err)
+	}
+	if _, ok := denylist.deniedUsers["alice"]; !ok {
+		t.Error("access tokens of alice were not revoked")
+	}
+}
+
+func TestRevokeAccessTokensDeniesTokensIssuedBefore(t *testing.T) {
+	s := newOAuthTestService(t)
+	s.config.TokenRevokers = []string{"user-service"}
+
+	before := issueTestAccessToken(t, s, &claims{userId: "alice", username: "alice", sessionId: "session"})
+
+	ctx := serviceauth.NewContext(context.Background(), serviceauth.Identity{Service: "user-service", Mode: serviceauth.ModeToken})
+	if err := s.RevokeAccessTokens(ctx, "alice"); err != nil {
+		t.Fatalf("RevokeAccessTokens: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+
+	after := issueTestAccessToken(t, s, &claims{userId: "alice", username: "alice", sessionId: "session"})
+
+	if _, err := s.verifyAccessToken(context.Background(), before); !errors.Is(err, errInactiveToken) {
+		t.Errorf("token issued before the revocation still accepted: %v", err)
+	}
+	if _, err := s.verifyAccessToken(context.Background(), after); err != nil {
+		t.Errorf("token issued after the revocation rejected: %v", err)
+	}
+}
+
+func TestPasswordFailuresShareTheLoginLockout(t *testing.T) {
+	s := newOAuthTestService(t)
+	ctx := context.Background()
+
+	for range 3 {
+		if err := s.CheckPasswordGuard(ctx, "alice"); err != nil {
+			t.Fatalf("locked before reaching the threshold: %v", err)
+		}
+		if err := s.RecordPasswordFailure(ctx, "alice"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.CheckPasswordGuard(ctx, "alice"); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("CheckPasswordGuard after repeated failures = %v, want ResourceExhausted", err)
+	}
+	if err := s.loginGuard.Check(ctx, "alice", "10.0.0.1"); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("login after repeated password change failures = %v, want ResourceExhausted", err)
+	}
+}
@@ -0,0 +1,262 @@
+package service
+
+import (
+	"auth-service/config"
+	"auth-service/dto"
+	"auth-service/models"
+	"auth-service/repository"
+	userpb "auth-service/user-pb"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// The fakes below implement what the service tests exercise; calling any
+// other method panics through the embedded nil interface.
+
+type fakeAuthRepository struct {
+	repository.AuthRepository
+
+	mu             sync.Mutex
+	refreshTokens  []dto.SaveRefreshToken
+	revocations    []dto.RevokeRefreshTokens
+	securityEvents []dto.SaveSecurityEvent
+}
+
+func (r *fakeAuthRepository) SaveRefreshToken(ctx context.Context, data *dto.SaveRefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.refreshTokens = append(r.refreshTokens, *data)
+	return nil
+}
+
+func (r *fakeAuthRepository) IsFamilyRevoked(ctx context.Context, familyID string) (bool, error) {
+	return false, nil
+}
+
+func (r *fakeAuthRepository) RevokeRefreshTokens(ctx context.Context, filter *dto.RevokeRefreshTokens) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.revocations = append(r.revocations, *filter)
+	return 0, nil
+}
+
+func (r *fakeAuthRepository) SaveSecurityEvent(ctx context.Context, data *dto.SaveSecurityEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.securityEvents = append(r.securityEvents, *data)
+	return nil
+}
+
+type fakeDenylistRepository struct {
+	repository.DenylistRepository
+
+	mu          sync.Mutex
+	deniedUsers map[string]time.Time
+}
+
+func (r *fakeDenylistRepository) DenyUser(ctx context.Context, userID string, revokedAt, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.deniedUsers == nil {
+		r.deniedUsers = make(map[string]time.Time)
+	}
+	r.deniedUsers[userID] = revokedAt.Truncate(time.Microsecond)
+	return nil
+}
+
+func (r *fakeDenylistRepository) IsDenied(ctx context.Context, jti, userID string, issuedAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	revokedAt, ok := r.deniedUsers[userID]
+	return ok && !revokedAt.Before(issuedAt.Truncate(time.Microsecond)), nil
+}
+
+type fakeFederationRepository struct {
+	mu         sync.Mutex
+	states     map[string]models.FederatedLoginState
+	identities map[string]models.FederatedIdentity
+}
+
+func newFakeFederationRepository() *fakeFederationRepository {
+	return &fakeFederationRepository{
+		states:     make(map[string]models.FederatedLoginState),
+		identities: make(map[string]models.FederatedIdentity),
+	}
+}
+
+func (r *fakeFederationRepository) SaveFederatedLoginState(ctx context.Context, data *dto.SaveFederatedLoginState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.states[data.StateHash] = models.FederatedLoginState{
+		StateHash:    data.StateHash,
+		Provider:     data.Provider,
+		CodeVerifier: data.CodeVerifier,
+		Nonce:        data.Nonce,
+		LinkUserID:   data.LinkUserID,
+		RememberMe:   data.RememberMe,
+		ExpiresAt:    data.Expiration,
+	}
+	return nil
+}
+
+func (r *fakeFederationRepository) ConsumeFederatedLoginState(ctx context.Context, stateHash string) (*models.FederatedLoginState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state, ok := r.states[stateHash]
+	if !ok {
+		return nil, repository.ErrEntityNotFound
+	}
+	delete(r.states, stateHash)
+	return &state, nil
+}
+
+func (r *fakeFederationRepository) GetFederatedIdentity(ctx context.Context, provider, subject string) (*models.FederatedIdentity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	identity, ok := r.identities[provider+"|"+subject]
+	if !ok {
+		return nil, repository.ErrEntityNotFound
+	}
+	return &identity, nil
+}
+
+func (r *fakeFederationRepository) SaveFederatedIdentity(ctx context.Context, data *dto.SaveFederatedIdentity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.identities[data.Provider+"|"+data.Subject] = models.FederatedIdentity{
+		Provider: data.Provider,
+		Subject:  data.Subject,
+		UserID:   data.UserID,
+		Email:    data.Email,
+	}
+	return nil
+}
+
+type fakeOAuthRepository struct {
+	repository.OAuthRepository
+
+	mu      sync.Mutex
+	clients map[string]models.OAuthClient
+}
+
+func (r *fakeOAuthRepository) GetOAuthClient(ctx context.Context, id string) (*models.OAuthClient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	client, ok := r.clients[id]
+	if !ok {
+		return nil, repository.ErrEntityNotFound
+	}
+	return &client, nil
+}
+
+func (r *fakeOAuthRepository) DeleteOAuthClient(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.clients[id]; !ok {
+		return repository.ErrEntityNotFound
+	}
+	delete(r.clients, id)
+	return nil
+}
+
+type fakeUserService struct {
+	userpb.UserServiceClient
+
+	mu    sync.Mutex
+	users map[string]*userpb.User
+}
+
+func newFakeUserService(users ...*userpb.User) *fakeUserService {
+	s := &fakeUserService{users: make(map[string]*userpb.User)}
+	for _, user := range users {
+		s.users[user.Id] = user
+	}
+	return s
+}
+
+func (s *fakeUserService) GetUserById(ctx context.Context, in *userpb.GetUserByIdRequest, opts ...grpc.CallOption) (*userpb.GetUserResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[in.GetId()]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	return &userpb.GetUserResponse{User: user}, nil
+}
+
+func (s *fakeUserService) GetUserByEmail(ctx context.Context, in *userpb.GetUserByEmailRequest, opts ...grpc.CallOption) (*userpb.GetUserResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, user := range s.users {
+		if user.Email == in.GetEmail() {
+			return &userpb.GetUserResponse{User: user}, nil
+		}
+	}
+	return nil, status.Error(codes.NotFound, "user not found")
+}
+
+func (s *fakeUserService) ProvisionUser(ctx context.Context, in *userpb.ProvisionUserRequest, opts ...grpc.CallOption) (*userpb.CreateUserResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, user := range s.users {
+		if user.Username == in.GetUsername() {
+			return nil, status.Error(codes.AlreadyExists, "username taken")
+		}
+	}
+
+	id := fmt.Sprintf("provisioned-%d", len(s.users)+1)
+	s.users[id] = &userpb.User{Id: id, Username: in.GetUsername(), Name: in.GetName(), Email: in.GetEmail()}
+	return &userpb.CreateUserResponse{Id: id}, nil
+}
+
+func newTestKeyring(t *testing.T) *Keyring {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Keyring{keys: []config.SigningKey{{
+		ID:        "test",
+		Algorithm: config.AlgorithmEdDSA,
+		Key:       key,
+		CreatedAt: time.Now().Add(-time.Hour),
+	}}}
+}
+
+func newTestConfig() *config.Config {
+	return &config.Config{
+		AccessTTL:          time.Hour,
+		RefreshTTL:         24 * time.Hour,
+		RefreshSecret:      []byte("test"),
+		SessionMaxLifetime: 30 * 24 * time.Hour,
+		OIDCStateTTL:       5 * time.Minute,
+	}
+}
+
+// withBearer returns a context carrying token as an incoming gRPC request
+// would.
+func withBearer(ctx context.Context, token string) context.Context {
+	return metadata.NewIncomingContext(ctx, metadata.Pairs(authorizationHeader, "Bearer "+token))
+}
+
+// issueTestAccessToken signs an access token carrying c.
+func issueTestAccessToken(t *testing.T, s *authService, c *claims) string {
+	t.Helper()
+
+	token, _, err := issueJwtToken(c, s.config.AccessTTL, s.keyring.SigningKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
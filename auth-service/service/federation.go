@@ -0,0 +1,252 @@
+package service
+
+import (
+	"auth-service/dto"
+	"auth-service/models"
+	"auth-service/repository"
+	userpb "auth-service/user-pb"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	securityEventIdentityLinked = "federated_identity_linked"
+	maxProvisionAttempts        = 3
+)
+
+var invalidUsernameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// BeginFederatedLogin starts an authorization code flow with PKCE against the
+// named identity provider and returns the URL to send the user to. With link
+// set, the identity is attached to the calling user instead of signing in.
+func (s *authService) BeginFederatedLogin(ctx context.Context, providerName string, link, rememberMe bool) (*FederatedLoginRedirect, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "unknown identity provider")
+	}
+
+	var linkUserID string
+	if link {
+		// Linking adds a way to sign in, so it takes the user's own session.
+		caller, err := s.authenticateInteractive(ctx)
+		if err != nil {
+			return nil, err
+		}
+		linkUserID = caller.Subject
+	}
+
+	oauthConfig, _, err := provider.discover(ctx)
+	if err != nil {
+		log.Print(err)
+		return nil, status.Error(codes.Unavailable, "identity provider is unavailable")
+	}
+
+	state, expiration := issueOpaqueToken(s.config.OIDCStateTTL)
+	nonce, _ := issueOpaqueToken(0)
+	verifier := oauth2.GenerateVerifier()
+
+	saveDto := &dto.SaveFederatedLoginState{
+		StateHash:    hashOpaqueToken(state),
+		Provider:     providerName,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		LinkUserID:   linkUserID,
+		RememberMe:   rememberMe,
+		Expiration:   expiration,
+	}
+	if err := s.federation.SaveFederatedLoginState(ctx, saveDto); err != nil {
+		log.Printf("failed to save federated login state: %v", err)
+		return nil, status.Error(codes.Internal, "failed to start federated login")
+	}
+
+	url := oauthConfig.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier), oidc.Nonce(nonce))
+	return &FederatedLoginRedirect{URL: url, State: state, ExpiresAt: expiration}, nil
+}
+
+// CompleteFederatedLogin redeems the authorization code returned by the
+// identity provider and starts a session for the account behind it.
+func (s *authService) CompleteFederatedLogin(ctx context.Context, state, code string) (*Tokens, error) {
+	loginState, err := s.federation.ConsumeFederatedLoginState(ctx, hashOpaqueToken(state))
+	if errors.Is(err, repository.ErrEntityNotFound) {
+		return nil, status.Error(codes.Unauthenticated, "unknown federated login state")
+	} else if err != nil {
+		log.Printf("failed to get federated login state: %v", err)
+		return nil, status.Error(codes.Internal, "failed to complete federated login")
+	}
+
+	if time.Now().After(loginState.ExpiresAt) {
+		return nil, status.Error(codes.Unauthenticated, "federated login expired")
+	}
+
+	provider, ok := s.providers[loginState.Provider]
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "unknown identity provider")
+	}
+
+	oauthConfig, verifier, err := provider.discover(ctx)
+	if err != nil {
+		log.Print(err)
+		return nil, status.Error(codes.Unavailable, "identity provider is unavailable")
+	}
+
+	oauthToken, err := oauthConfig.Exchange(ctx, code, oauth2.VerifierOption(loginState.CodeVerifier))
+	if err != nil {
+		log.Printf("failed to exchange authorization code with %s: %v", loginState.Provider, err)
+		return nil, status.Error(codes.Unauthenticated, "failed to redeem authorization code")
+	}
+
+	rawIDToken, ok := oauthToken.Extra("id_token").(string)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "identity provider returned no id token")
+	}
+
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		log.Printf("failed to verify id token from %s: %v", loginState.Provider, err)
+		return nil, status.Error(codes.Unauthenticated, "invalid id token")
+	}
+	if idToken.Nonce != loginState.Nonce {
+		return nil, status.Error(codes.Unauthenticated, "invalid id token")
+	}
+
+	var claims federatedClaims
+	if err := idToken.Claims(&claims); err != nil {
+		log.Printf("failed to decode id token claims: %v", err)
+		return nil, status.Error(codes.Unauthenticated, "invalid id token")
+	}
+
+	userID, err := s.resolveFederatedUser(ctx, provider, loginState, idToken.Subject, &claims)
+	if err != nil {
+		return nil, err
+	}
+
+	userRes, err := s.userService.GetUserById(ctx, &userpb.GetUserByIdRequest{Id: userID})
+	if err != nil {
+		log.Printf("failed to get user: %v", err)
+		return nil, status.Error(codes.Internal, "failed to complete federated login")
+	}
+
+	return s.startSession(ctx, userRes.GetUser(), clientInfoFromContext(ctx, s.config.TrustedProxies), sessionGrant{rememberMe: loginState.RememberMe})
+}
+
+// resolveFederatedUser finds the local account for an external identity. In
+// order: an existing link, an explicit link requested by a signed-in user, an
+// account with the same verified email, and finally a newly provisioned one.
+func (s *authService) resolveFederatedUser(ctx context.Context, provider *federatedProvider, loginState *models.FederatedLoginState, subject string, claims *federatedClaims) (string, error) {
+	providerName := provider.config.Name
+
+	identity, err := s.federation.GetFederatedIdentity(ctx, providerName, subject)
+	if err == nil {
+		if loginState.LinkUserID != "" && loginState.LinkUserID != identity.UserID {
+			return "", status.Error(codes.AlreadyExists, "identity is already linked to another account")
+		}
+		return identity.UserID, nil
+	} else if !errors.Is(err, repository.ErrEntityNotFound) {
+		log.Printf("failed to get federated identity: %v", err)
+		return "", status.Error(codes.Internal, "failed to complete federated login")
+	}
+
+	var userID string
+	switch {
+	case loginState.LinkUserID != "":
+		userID = loginState.LinkUserID
+
+	case provider.config.LinkByEmail && claims.EmailVerified && claims.Email != "":
+		userRes, err := s.userService.GetUserByEmail(ctx, &userpb.GetUserByEmailRequest{Email: claims.Email})
+		if err == nil {
+			userID = userRes.GetUser().GetId()
+		} else if status.Code(err) != codes.NotFound {
+			log.Printf("failed to get user by email: %v", err)
+			return "", status.Error(codes.Internal, "failed to complete federated login")
+		}
+	}
+
+	if userID == "" {
+		if !provider.config.AutoProvision {
+			return "", status.Error(codes.PermissionDenied, "no account is linked to this identity")
+		}
+		if userID, err = s.provisionFederatedUser(ctx, providerName, subject, claims); err != nil {
+			return "", err
+		}
+	}
+
+	saveDto := &dto.SaveFederatedIdentity{
+		Provider: providerName,
+		Subject:  subject,
+		UserID:   userID,
+		Email:    claims.Email,
+	}
+	if err := s.federation.SaveFederatedIdentity(ctx, saveDto); err != nil {
+		log.Printf("failed to save federated identity: %v", err)
+		return "", status.Error(codes.Internal, "failed to complete federated login")
+	}
+
+	event := &dto.SaveSecurityEvent{
+		Type:    securityEventIdentityLinked,
+		UserID:  userID,
+		Details: fmt.Sprintf("linked %s identity %s", providerName, subject),
+	}
+	if err := s.repository.SaveSecurityEvent(ctx, event); err != nil {
+		log.Printf("failed to record security event: %v", err)
+	}
+
+	return userID, nil
+}
+
+// provisionFederatedUser creates an account for a first-time federated user,
+// adding a random suffix to the username when it is already taken.
+func (s *authService) provisionFederatedUser(ctx context.Context, providerName, subject string, claims *federatedClaims) (string, error) {
+	req := &userpb.ProvisionUserRequest{Name: claims.Name}
+	if claims.EmailVerified {
+		req.Email = claims.Email
+	}
+
+	base := federatedUsername(providerName, subject, claims)
+	for attempt := range maxProvisionAttempts {
+		req.Username = base
+		if attempt > 0 {
+			req.Username = base + "-" + randomSuffix()
+		}
+
+		res, err := s.userService.ProvisionUser(ctx, req)
+		if err == nil {
+			return res.GetId(), nil
+		} else if status.Code(err) != codes.AlreadyExists {
+			log.Printf("failed to provision user: %v", err)
+			return "", status.Error(codes.Internal, "failed to complete federated login")
+		}
+	}
+
+	return "", status.Error(codes.AlreadyExists, "could not create an account for this identity")
+}
+
+func federatedUsername(providerName, subject string, claims *federatedClaims) string {
+	candidate := claims.PreferredUsername
+	if candidate == "" {
+		candidate, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	candidate = strings.Trim(invalidUsernameChars.ReplaceAllString(candidate, ""), ".-_")
+	if candidate == "" {
+		candidate = providerName + "-" + hashOpaqueToken(subject)[:8]
+	}
+	return candidate
+}
+
+func randomSuffix() string {
+	b := make([]byte, 3)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,425 @@
+package service
+
+import (
+	"auth-service/config"
+	"auth-service/models"
+	userpb "auth-service/user-pb"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const testProvider = "mock"
+
+// mockIdP is a minimal OpenID Connect provider: discovery, JWKS and a token
+// endpoint that enforces PKCE. The authorization endpoint is skipped; tests
+// call authorize with the URL the user would have been sent to.
+type mockIdP struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+
+	mu     sync.Mutex
+	codes  map[string]mockAuthorization
+	nextID int
+
+	// claims are added to every ID token. nonce, when set, replaces the one
+	// from the authorization request.
+	subject string
+	claims  map[string]any
+	nonce   string
+}
+
+type mockAuthorization struct {
+	challenge string
+	nonce     string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &mockIdP{
+		key:      key,
+		clientID: "chat",
+		codes:    make(map[string]mockAuthorization),
+		subject:  "idp-user-1",
+		claims:   map[string]any{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/jwks", idp.jwks)
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+func (idp *mockIdP) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                idp.server.URL,
+		"authorization_endpoint":                idp.server.URL + "/authorize",
+		"token_endpoint":                        idp.server.URL + "/token",
+		"jwks_uri":                              idp.server.URL + "/jwks",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (idp *mockIdP) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "idp",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	idp.mu.Lock()
+	authorization, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != authorization.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	nonce := authorization.nonce
+	if idp.nonce != "" {
+		nonce = idp.nonce
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   idp.server.URL,
+		"sub":   idp.subject,
+		"aud":   idp.clientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Minute).Unix(),
+		"nonce": nonce,
+	}
+	for name, value := range idp.claims {
+		claims[name] = value
+	}
+
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	t.Header["kid"] = "idp"
+	idToken, err := t.SignedString(idp.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": "idp-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     idToken,
+	})
+}
+
+// authorize plays the user approving the request at the provider and returns
+// the authorization code it would redirect back with.
+func (idp *mockIdP) authorize(t *testing.T, authorizationURL string) string {
+	t.Helper()
+
+	u, err := url.Parse(authorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("authorization request does not use PKCE: %s", authorizationURL)
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.nextID++
+	code := "code-" + strconv.Itoa(idp.nextID)
+	idp.codes[code] = mockAuthorization{
+		challenge: query.Get("code_challenge"),
+		nonce:     query.Get("nonce"),
+	}
+	return code
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+type federationTest struct {
+	service    *authService
+	idp        *mockIdP
+	users      *fakeUserService
+	federation *fakeFederationRepository
+	repository *fakeAuthRepository
+}
+
+func newFederationTest(t *testing.T, provider config.OIDCProvider, users ...*userpb.User) *federationTest {
+	t.Helper()
+
+	idp := newMockIdP(t)
+	provider.Name = testProvider
+	provider.Issuer = idp.server.URL
+	provider.ClientID = idp.clientID
+	provider.RedirectURL = "http://localhost/callback"
+	provider.Scopes = []string{"openid", "email"}
+
+	cfg := newTestConfig()
+	cfg.OIDCProviders = []config.OIDCProvider{provider}
+
+	ft := &federationTest{
+		idp:        idp,
+		users:      newFakeUserService(users...),
+		federation: newFakeFederationRepository(),
+		repository: &fakeAuthRepository{},
+	}
+	ft.service = &authService{
+		repository:  ft.repository,
+		denylist:    &fakeDenylistRepository{},
+		federation:  ft.federation,
+		providers:   NewFederatedProviders(cfg),
+		userService: ft.users,
+		config:      cfg,
+		keyring:     newTestKeyring(t),
+	}
+	return ft
+}
+
+// signIn runs the whole flow and returns the state used, for replay tests.
+func (ft *federationTest) signIn(t *testing.T, ctx context.Context, link bool) (string, *Tokens, error) {
+	t.Helper()
+
+	redirect, err := ft.service.BeginFederatedLogin(ctx, testProvider, link, false)
+	if err != nil {
+		t.Fatalf("BeginFederatedLogin: %v", err)
+	}
+	code := ft.idp.authorize(t, redirect.URL)
+
+	tokens, err := ft.service.CompleteFederatedLogin(ctx, redirect.State, code)
+	return redirect.State, tokens, err
+}
+
+func (ft *federationTest) linkedUser(subject string) string {
+	ft.federation.mu.Lock()
+	defer ft.federation.mu.Unlock()
+	return ft.federation.identities[testProvider+"|"+subject].UserID
+}
+
+func TestFederatedLoginProvisionsAccount(t *testing.T) {
+	ft := newFederationTest(t, config.OIDCProvider{AutoProvision: true})
+	ft.idp.claims["preferred_username"] = "alice"
+	ft.idp.claims["email"] = "alice@example.com"
+	ft.idp.claims["email_verified"] = true
+
+	_, tokens, err := ft.signIn(t, context.Background(), false)
+	if err != nil {
+		t.Fatalf("CompleteFederatedLogin: %v", err)
+	}
+	if tokens.Access == "" || tokens.Refresh == "" {
+		t.Fatal("no tokens issued")
+	}
+
+	userID := ft.linkedUser(ft.idp.subject)
+	if userID == "" {
+		t.Fatal("identity was not linked to the provisioned account")
+	}
+	if user := ft.users.users[userID]; user.Username != "alice" || user.Email != "alice@example.com" {
+		t.Errorf("provisioned %+v, want username alice with the verified email", user)
+	}
+
+	// Signing in again reuses the link instead of provisioning another account.
+	if _, _, err := ft.signIn(t, context.Background(), false); err != nil {
+		t.Fatalf("second sign-in: %v", err)
+	}
+	if len(ft.users.users) != 1 {
+		t.Errorf("got %d accounts, want 1", len(ft.users.users))
+	}
+}
+
+func TestFederatedLoginWithoutProvisioningRejectsUnknownIdentity(t *testing.T) {
+	ft := newFederationTest(t, config.OIDCProvider{})
+
+	_, _, err := ft.signIn(t, context.Background(), false)
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("got %v, want PermissionDenied", err)
+	}
+	if len(ft.users.users) != 0 {
+		t.Error("an account was provisioned")
+	}
+}
+
+func TestFederatedLoginRejectsReplayedState(t *testing.T) {
+	ft := newFederationTest(t, config.OIDCProvider{AutoProvision: true})
+
+	state, _, err := ft.signIn(t, context.Background(), false)
+	if err != nil {
+		t.Fatalf("CompleteFederatedLogin: %v", err)
+	}
+
+	// A fresh code must not make a used state valid again.
+	redirect, err := ft.service.BeginFederatedLogin(context.Background(), testProvider, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := ft.idp.authorize(t, redirect.URL)
+
+	_, err = ft.service.CompleteFederatedLogin(context.Background(), state, code)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("got %v, want Unauthenticated", err)
+	}
+}
+
+func TestFederatedLoginEnforcesPKCE(t *testing.T) {
+	ft := newFederationTest(t, config.OIDCProvider{AutoProvision: true})
+
+	// An intercepted code redeemed through another login's state is sent
+	// with that login's verifier, which the provider rejects.
+	victim, err := ft.service.BeginFederatedLogin(context.Background(), testProvider, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attacker, err := ft.service.BeginFederatedLogin(context.Background(), testProvider, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := ft.idp.authorize(t, victim.URL)
+
+	_, err = ft.service.CompleteFederatedLogin(context.Background(), attacker.State, code)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("got %v, want Unauthenticated", err)
+	}
+	if ft.linkedUser(ft.idp.subject) != "" {
+		t.Error("identity was linked")
+	}
+}
+
+func TestFederatedLoginRejectsNonceMismatch(t *testing.T) {
+	ft := newFederationTest(t, config.OIDCProvider{AutoProvision: true})
+	ft.idp.nonce = "replayed-nonce"
+
+	_, _, err := ft.signIn(t, context.Background(), false)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("got %v, want Unauthenticated", err)
+	}
+	if ft.linkedUser(ft.idp.subject) != "" {
+		t.Error("identity was linked")
+	}
+}
+
+func TestFederatedLinkAttachesIdentityToCaller(t *testing.T) {
+	bob := &userpb.User{Id: "bob", Username: "bob"}
+	ft := newFederationTest(t, config.OIDCProvider{}, bob)
+
+	access := issueTestAccessToken(t, ft.service, &claims{userId: bob.Id, username: bob.Username, sessionId: "bob-session"})
+	if _, _, err := ft.signIn(t, withBearer(context.Background(), access), true); err != nil {
+		t.Fatalf("CompleteFederatedLogin: %v", err)
+	}
+
+	if got := ft.linkedUser(ft.idp.subject); got != bob.Id {
+		t.Errorf("identity linked to %q, want %q", got, bob.Id)
+	}
+	if len(ft.repository.securityEvents) != 1 || ft.repository.securityEvents[0].Type != securityEventIdentityLinked {
+		t.Errorf("got security events %+v, want one identity link", ft.repository.securityEvents)
+	}
+}
+
+func TestFederatedLinkRequiresUserSession(t *testing.T) {
+	bob := &userpb.User{Id: "bob", Username: "bob"}
+	ft := newFederationTest(t, config.OIDCProvider{}, bob)
+
+	access := issueTestAccessToken(t, ft.service, &claims{userId: bob.Id, username: bob.Username, sessionId: "bob-session", clientId: "third-party"})
+	_, err := ft.service.BeginFederatedLogin(withBearer(context.Background(), access), testProvider, true, false)
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("got %v, want PermissionDenied", err)
+	}
+
+	_, err = ft.service.BeginFederatedLogin(context.Background(), testProvider, true, false)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("got %v without a token, want Unauthenticated", err)
+	}
+}
+
+func TestFederatedLinkRejectsIdentityOfAnotherAccount(t *testing.T) {
+	alice := &userpb.User{Id: "alice", Username: "alice"}
+	bob := &userpb.User{Id: "bob", Username: "bob"}
+	ft := newFederationTest(t, config.OIDCProvider{}, alice, bob)
+	ft.federation.identities[testProvider+"|"+ft.idp.subject] = models.FederatedIdentity{Provider: testProvider, Subject: ft.idp.subject, UserID: alice.Id}
+
+	access := issueTestAccessToken(t, ft.service, &claims{userId: bob.Id, username: bob.Username, sessionId: "bob-session"})
+	_, _, err := ft.signIn(t, withBearer(context.Background(), access), true)
+	if status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("got %v, want AlreadyExists", err)
+	}
+}
+
+func TestFederatedLoginLinksByVerifiedEmailOnlyWhenEnabled(t *testing.T) {
+	carol := &userpb.User{Id: "carol", Username: "carol", Email: "carol@example.com"}
+
+	tests := []struct {
+		name          string
+		linkByEmail   bool
+		emailVerified bool
+		wantUser      string
+	}{
+		{name: "enabled and verified", linkByEmail: true, emailVerified: true, wantUser: carol.Id},
+		{name: "enabled but unverified", linkByEmail: true, emailVerified: false},
+		{name: "disabled", linkByEmail: false, emailVerified: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ft := newFederationTest(t, config.OIDCProvider{LinkByEmail: tt.linkByEmail}, carol)
+			ft.idp.claims["email"] = carol.Email
+			ft.idp.claims["email_verified"] = tt.emailVerified
+
+			_, _, err := ft.signIn(t, context.Background(), false)
+			if tt.wantUser == "" {
+				if status.Code(err) != codes.PermissionDenied {
+					t.Fatalf("got %v, want PermissionDenied", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CompleteFederatedLogin: %v", err)
+			}
+			if got := ft.linkedUser(ft.idp.subject); got != tt.wantUser {
+				t.Errorf("identity linked to %q, want %q", got, tt.wantUser)
+			}
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package service
+
+import (
+	"auth-service/config"
+	"auth-service/repository"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	keyRotatorLease = "signing-key-rotator"
+
+	// keyBootstrapTimeout bounds how long a replica started without keys
+	// waits for the rotator to write the first one.
+	keyBootstrapTimeout = 30 * time.Second
+)
+
+// Keyring holds the keys used to sign and verify access tokens. The newest key
+// signs once every replica has had time to load it; older keys stay published
+// until every token they signed has expired. Replicas sharing the keys
+// directory compete for a lease so that only one of them rotates.
+type Keyring struct {
+	mu   sync.RWMutex
+	keys []config.SigningKey
+
+	leases repository.LeaseRepository
+	holder string
+
+	dir              string
+	rotationInterval time.Duration
+	reloadInterval   time.Duration
+	accessTTL        time.Duration
+}
+
+func NewKeyring(cfg *config.Config, leases repository.LeaseRepository) (*Keyring, error) {
+	k := &Keyring{
+		keys:             cfg.SigningKeys,
+		leases:           leases,
+		holder:           newLeaseHolderID(),
+		dir:              cfg.SigningKeysDir,
+		rotationInterval: cfg.KeyRotationInterval,
+		reloadInterval:   cfg.KeyReloadInterval,
+		accessTTL:        cfg.AccessTTL,
+	}
+
+	ctx := context.Background()
+	if err := k.rotate(ctx); err != nil {
+		return nil, err
+	}
+	if err := k.awaitKeys(ctx); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// Run reloads the keys directory on a schedule so keys added or removed by
+// operators (or by other replicas sharing the directory) are picked up, and
+// rotates the signing key once it is older than the rotation interval.
+func (k *Keyring) Run(ctx context.Context) {
+	if k.reloadInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(k.reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := k.reload(); err != nil {
+				log.Printf("failed to reload signing keys: %v", err)
+				continue
+			}
+			if err := k.rotate(ctx); err != nil {
+				log.Printf("failed to rotate signing keys: %v", err)
+			}
+		}
+	}
+}
+
+// SigningKey returns the newest key that other replicas have had a reload
+// interval to pick up, so tokens it signs verify everywhere. A lone key is
+// used right away.
+func (k *Keyring) SigningKey() config.SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	now := time.Now()
+	for i := len(k.keys) - 1; i > 0; i-- {
+		if now.Sub(k.keys[i].CreatedAt) >= k.reloadInterval {
+			return k.keys[i]
+		}
+	}
+	return k.keys[0]
+}
+
+func (k *Keyring) VerificationKey(kid string) (config.SigningKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, key := range k.keys {
+		if key.ID == kid {
+			return key, true
+		}
+	}
+	return config.SigningKey{}, false
+}
+
+func (k *Keyring) PublicKeys() []JsonWebKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	jwks := make([]JsonWebKey, 0, len(k.keys))
+	for _, key := range k.keys {
+		jwks = append(jwks, toJsonWebKey(key))
+	}
+	return jwks
+}
+
+func (k *Keyring) reload() error {
+	keys, err := config.LoadSigningKeys(k.dir)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no signing keys found in %s", k.dir)
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.mu.Unlock()
+	return nil
+}
+
+// rotate generates a new signing key when automatic rotation is enabled, this
+// replica holds the rotator lease and the current key is due, then drops keys
+// that can no longer have signed a valid token.
+func (k *Keyring) rotate(ctx context.Context) error {
+	if k.rotationInterval <= 0 {
+		return nil
+	}
+
+	// The lease outlives one reload so the rotator keeps it between runs.
+	ttl := max(k.reloadInterval+k.reloadInterval/2, time.Minute)
+	leader, err := k.leases.AcquireLease(ctx, keyRotatorLease, k.holder, ttl)
+	if err != nil {
+		return fmt.Errorf("failed to acquire signing key rotator lease: %w", err)
+	}
+	if !leader {
+		return nil
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := time.Now()
+	if len(k.keys) == 0 || now.Sub(k.keys[len(k.keys)-1].CreatedAt) >= k.rotationInterval {
+		key, err := generateSigningKey(now)
+		if err != nil {
+			return err
+		}
+		if err := config.WriteSigningKey(k.dir, key); err != nil {
+			return err
+		}
+		k.keys = append(k.keys, key)
+		log.Printf("rotated access token signing key, new kid %s", key.ID)
+	}
+
+	// A key stops signing a reload interval after its successor appears.
+	retained := k.keys[:0]
+	for i, key := range k.keys {
+		if i < len(k.keys)-1 && now.Sub(k.keys[i+1].CreatedAt) > k.reloadInterval+k.accessTTL {
+			if err := os.Remove(filepath.Join(k.dir, key.ID+".pem")); err != nil && !os.IsNotExist(err) {
+				log.Printf("failed to remove retired signing key %s: %v", key.ID, err)
+			}
+			continue
+		}
+		retained = append(retained, key)
+	}
+	k.keys = retained
+
+	return nil
+}
+
+// awaitKeys waits for the rotator to write the first key when this replica
+// started without any.
+func (k *Keyring) awaitKeys(ctx context.Context) error {
+	deadline := time.Now().Add(keyBootstrapTimeout)
+	for {
+		k.mu.RLock()
+		n := len(k.keys)
+		k.mu.RUnlock()
+		if n > 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("no signing keys found in %s", k.dir)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+		if err := k.reload(); err != nil {
+			log.Printf("waiting for signing keys: %v", err)
+		}
+	}
+}
+
+func generateSigningKey(now time.Time) (config.SigningKey, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return config.SigningKey{}, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	// The random suffix keeps kids unique when keys are created within the
+	// same second.
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+
+	return config.SigningKey{
+		ID:        now.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix),
+		Algorithm: config.AlgorithmEdDSA,
+		Key:       private,
+		CreatedAt: now,
+	}, nil
+}
+
+func toJsonWebKey(key config.SigningKey) JsonWebKey {
+	jwk := JsonWebKey{
+		Kid: key.ID,
+		Use: "sig",
+		Alg: key.Algorithm,
+	}
+
+	switch public := key.Public().(type) {
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	}
+
+	return jwk
+}
+
+func newLeaseHolderID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "auth-service"
+	}
+
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return host + "-" + hex.EncodeToString(suffix)
+}
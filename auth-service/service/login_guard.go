@@ -0,0 +1,183 @@
+package service
+
+import (
+	"auth-service/config"
+	"auth-service/repository"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// LoginGuard throttles password guessing. Failures are counted per username
+// and per client IP; once a counter reaches its threshold the key is locked
+// for a period that doubles with every further failure.
+type LoginGuard struct {
+	attempts repository.LoginAttemptRepository
+	config   *config.Config
+}
+
+func NewLoginGuard(attempts repository.LoginAttemptRepository, config *config.Config) *LoginGuard {
+	return &LoginGuard{
+		attempts: attempts,
+		config:   config,
+	}
+}
+
+// Check rejects the login with ResourceExhausted while the username or the
+// client IP is locked out.
+func (g *LoginGuard) Check(ctx context.Context, username, ip string) error {
+	return g.check(ctx, g.keys(usernameKey(username), ip))
+}
+
+func (g *LoginGuard) RecordFailure(ctx context.Context, username, ip string) {
+	g.recordFailure(ctx, g.keys(usernameKey(username), ip))
+}
+
+// CheckClient and RecordClientFailure throttle client secret guessing at the
+// token endpoint the way logins are throttled, per client ID and client IP.
+func (g *LoginGuard) CheckClient(ctx context.Context, clientID, ip string) error {
+	return g.check(ctx, g.keys(clientKey(clientID), ip))
+}
+
+func (g *LoginGuard) RecordClientFailure(ctx context.Context, clientID, ip string) {
+	g.recordFailure(ctx, g.keys(clientKey(clientID), ip))
+}
+
+func (g *LoginGuard) check(ctx context.Context, keys []throttleKey) error {
+	now := time.Now()
+	var retryAfter time.Duration
+
+	for _, key := range keys {
+		attempt, err := g.attempts.GetLoginAttempt(ctx, key.name)
+		if err != nil {
+			log.Printf("failed to read login attempts: %v", err)
+			return status.Error(codes.Internal, "could not login")
+		}
+		if attempt.LockedUntil != nil && attempt.LockedUntil.After(now) {
+			retryAfter = max(retryAfter, attempt.LockedUntil.Sub(now))
+		}
+	}
+
+	if retryAfter > 0 {
+		return lockedOutError(retryAfter)
+	}
+	return nil
+}
+
+func (g *LoginGuard) recordFailure(ctx context.Context, keys []throttleKey) {
+	now := time.Now()
+
+	for _, key := range keys {
+		attempt, err := g.attempts.RecordLoginFailure(ctx, key.name, g.config.LoginFailureWindow)
+		if err != nil {
+			log.Printf("failed to record login failure: %v", err)
+			continue
+		}
+
+		if attempt.Failures < key.threshold {
+			continue
+		}
+
+		lockout := g.lockoutDuration(attempt.Failures - key.threshold)
+		if err := g.attempts.LockLogin(ctx, key.name, now.Add(lockout)); err != nil {
+			log.Printf("failed to lock login: %v", err)
+			continue
+		}
+		log.Printf("login locked for %s after %d failures", key.name, attempt.Failures)
+	}
+}
+
+// RecordSuccess clears the username counter. The IP counter is left alone so
+// a valid account cannot be used to reset throttling for guesses against
+// others from the same address.
+func (g *LoginGuard) RecordSuccess(ctx context.Context, username string) {
+	if err := g.attempts.ResetLoginAttempts(ctx, usernameKey(username)); err != nil {
+		log.Printf("failed to reset login attempts: %v", err)
+	}
+}
+
+func (g *LoginGuard) Unlock(ctx context.Context, username string) error {
+	return g.attempts.ResetLoginAttempts(ctx, usernameKey(username))
+}
+
+// AllowPasswordReset counts a password reset request and rejects it with
+// ResourceExhausted once the username or the client IP made too many within
+// the reset window, so the endpoint cannot be used to flood inboxes.
+func (g *LoginGuard) AllowPasswordReset(ctx context.Context, username, ip string) error {
+	keys := []throttleKey{{name: "reset:" + usernameKey(username), threshold: g.config.PasswordResetMaxRequests}}
+	if ip != "" {
+		keys = append(keys, throttleKey{name: "reset:ip:" + ip, threshold: g.config.PasswordResetMaxIPRequests})
+	}
+
+	exceeded := false
+	for _, key := range keys {
+		attempt, err := g.attempts.RecordLoginFailure(ctx, key.name, g.config.PasswordResetWindow)
+		if err != nil {
+			log.Printf("failed to record password reset request: %v", err)
+			return status.Error(codes.Internal, "failed to request password reset")
+		}
+		if attempt.Failures > key.threshold {
+			exceeded = true
+		}
+	}
+
+	if exceeded {
+		st := status.New(codes.ResourceExhausted, "too many password reset requests, retry later")
+		detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(g.config.PasswordResetWindow)})
+		if err != nil {
+			return st.Err()
+		}
+		return detailed.Err()
+	}
+	return nil
+}
+
+func (g *LoginGuard) lockoutDuration(excess int) time.Duration {
+	lockout := g.config.LoginLockoutBase
+	for range excess {
+		lockout *= 2
+		if lockout >= g.config.LoginLockoutMax {
+			return g.config.LoginLockoutMax
+		}
+	}
+	return min(lockout, g.config.LoginLockoutMax)
+}
+
+type throttleKey struct {
+	name      string
+	threshold int
+}
+
+// keys returns the counters for an account key, such as a username key, and
+// the client IP.
+func (g *LoginGuard) keys(account, ip string) []throttleKey {
+	keys := []throttleKey{{name: account, threshold: g.config.LoginMaxUserFailures}}
+	if ip != "" {
+		keys = append(keys, throttleKey{name: "ip:" + ip, threshold: g.config.LoginMaxIPFailures})
+	}
+	return keys
+}
+
+func usernameKey(username string) string {
+	return "user:" + username
+}
+
+func clientKey(clientID string) string {
+	return "client:" + clientID
+}
+
+func lockedOutError(retryAfter time.Duration) error {
+	retryAfter = max(retryAfter.Round(time.Second), time.Second)
+	st := status.New(codes.ResourceExhausted, fmt.Sprintf("too many failed login attempts, retry in %s", retryAfter))
+	detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
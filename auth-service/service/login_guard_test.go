@@ -0,0 +1,148 @@
+package service
+
+import (
+	"auth-service/config"
+	"auth-service/repository"
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newTestLoginGuard() *LoginGuard {
+	return NewLoginGuard(repository.NewMemoryLoginAttemptRepository(), &config.Config{
+		LoginMaxUserFailures: 3,
+		LoginMaxIPFailures:   5,
+		LoginFailureWindow:   time.Minute,
+		LoginLockoutBase:     30 * time.Second,
+		LoginLockoutMax:      4 * time.Minute,
+	})
+}
+
+func retryDelay(t *testing.T, err error) time.Duration {
+	t.Helper()
+
+	st := status.Convert(err)
+	if st.Code() != codes.ResourceExhausted {
+		t.Fatalf("got %v, want ResourceExhausted", err)
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			return info.GetRetryDelay().AsDuration()
+		}
+	}
+	t.Fatal("lockout error carries no RetryInfo")
+	return 0
+}
+
+func TestLoginGuardLocksUsernameAtThreshold(t *testing.T) {
+	ctx := context.Background()
+	g := newTestLoginGuard()
+
+	for range 2 {
+		g.RecordFailure(ctx, "alice", "10.0.0.1")
+	}
+	if err := g.Check(ctx, "alice", "10.0.0.1"); err != nil {
+		t.Fatalf("locked before reaching the threshold: %v", err)
+	}
+
+	g.RecordFailure(ctx, "alice", "10.0.0.1")
+	err := g.Check(ctx, "alice", "10.0.0.2")
+	if delay := retryDelay(t, err); delay != 30*time.Second {
+		t.Errorf("retry delay = %s, want 30s", delay)
+	}
+
+	if err := g.Check(ctx, "bob", "10.0.0.1"); err != nil {
+		t.Errorf("other user from the same address locked out: %v", err)
+	}
+}
+
+func TestLoginGuardBackoffDoublesUpToMax(t *testing.T) {
+	g := newTestLoginGuard()
+
+	want := []time.Duration{
+		30 * time.Second,
+		time.Minute,
+		2 * time.Minute,
+		4 * time.Minute,
+		4 * time.Minute,
+		4 * time.Minute,
+	}
+	for excess, w := range want {
+		if got := g.lockoutDuration(excess); got != w {
+			t.Errorf("lockoutDuration(%d) = %s, want %s", excess, got, w)
+		}
+	}
+	if got := g.lockoutDuration(1000); got != 4*time.Minute {
+		t.Errorf("lockoutDuration(1000) = %s, want the 4m cap", got)
+	}
+}
+
+func TestLoginGuardEscalatesWhileLocked(t *testing.T) {
+	ctx := context.Background()
+	g := newTestLoginGuard()
+
+	for range 5 {
+		g.RecordFailure(ctx, "alice", "")
+	}
+	// Failures three, four and five lock for 30s, 1m and 2m.
+	delay := retryDelay(t, g.Check(ctx, "alice", ""))
+	if delay < 119*time.Second || delay > 2*time.Minute {
+		t.Errorf("retry delay = %s, want about 2m", delay)
+	}
+}
+
+func TestLoginGuardLocksAddressAcrossUsernames(t *testing.T) {
+	ctx := context.Background()
+	g := newTestLoginGuard()
+
+	for _, username := range []string{"a", "b", "c", "d", "e"} {
+		g.RecordFailure(ctx, username, "10.0.0.1")
+	}
+
+	retryDelay(t, g.Check(ctx, "fresh", "10.0.0.1"))
+	if err := g.Check(ctx, "fresh", "10.0.0.2"); err != nil {
+		t.Errorf("user locked out from another address: %v", err)
+	}
+}
+
+func TestLoginGuardSuccessResetsOnlyUsername(t *testing.T) {
+	ctx := context.Background()
+	g := newTestLoginGuard()
+
+	for range 2 {
+		g.RecordFailure(ctx, "alice", "10.0.0.1")
+	}
+	g.RecordSuccess(ctx, "alice")
+	for range 2 {
+		g.RecordFailure(ctx, "alice", "10.0.0.1")
+	}
+	if err := g.Check(ctx, "alice", "10.0.0.3"); err != nil {
+		t.Errorf("username counter not reset by success: %v", err)
+	}
+
+	// The address keeps counting across the success, so a fifth failure
+	// from it locks it for everyone.
+	g.RecordFailure(ctx, "bob", "10.0.0.1")
+	retryDelay(t, g.Check(ctx, "carol", "10.0.0.1"))
+}
+
+func TestLoginGuardUnlock(t *testing.T) {
+	ctx := context.Background()
+	g := newTestLoginGuard()
+
+	for range 3 {
+		g.RecordFailure(ctx, "alice", "")
+	}
+	retryDelay(t, g.Check(ctx, "alice", ""))
+
+	if err := g.Unlock(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Check(ctx, "alice", ""); err != nil {
+		t.Errorf("still locked after Unlock: %v", err)
+	}
+}
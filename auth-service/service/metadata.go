@@ -0,0 +1,115 @@
+package service
+
+import (
+	"authkit/serviceauth"
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	authorizationHeader      = "authorization"
+	forwardedForHeader       = "x-forwarded-for"
+	forwardedUserAgentHeader = "x-forwarded-user-agent"
+	userAgentHeader          = "user-agent"
+
+	maxUserAgentLength = 255
+)
+
+func bearerTokenFromContext(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+
+	values := md.Get(authorizationHeader)
+	if len(values) == 0 {
+		return "", false
+	}
+
+	token, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok || token == "" {
+		return "", false
+	}
+
+	return token, true
+}
+
+type clientInfo struct {
+	ip        string
+	userAgent string
+}
+
+// clientInfoFromContext describes the device behind a request. When the
+// caller is one of trustedProxies, the end user's address and user agent are
+// taken from the headers it forwards, and the IP is left empty if it sent
+// none: the proxy's own address would make every user behind it share one
+// login throttle. Headers from anyone else are ignored so that direct callers
+// cannot pick the address they are throttled by.
+func clientInfoFromContext(ctx context.Context, trustedProxies []string) clientInfo {
+	var info clientInfo
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if isTrustedService(ctx, trustedProxies) {
+		if forwarded := md.Get(forwardedForHeader); len(forwarded) > 0 {
+			first, _, _ := strings.Cut(forwarded[0], ",")
+			info.ip = normalizeIP(strings.TrimSpace(first))
+		}
+		if ua := md.Get(forwardedUserAgentHeader); len(ua) > 0 {
+			info.userAgent = truncate(ua[0], maxUserAgentLength)
+		}
+		return info
+	}
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			host = p.Addr.String()
+		}
+		info.ip = normalizeIP(host)
+	}
+	if ua := md.Get(userAgentHeader); len(ua) > 0 {
+		info.userAgent = truncate(ua[0], maxUserAgentLength)
+	}
+
+	return info
+}
+
+// isTrustedService reports whether the calling service, as identified by
+// serviceauth, is one of services.
+func isTrustedService(ctx context.Context, services []string) bool {
+	if slices.Contains(services, serviceauth.AnyService) {
+		return true
+	}
+	id, ok := serviceauth.FromContext(ctx)
+	return ok && slices.Contains(services, id.Service)
+}
+
+// normalizeIP returns the canonical form of an IP address, or an empty string
+// if s is not one. Anything else, such as a forged header, would not fit the
+// client_ip column.
+func normalizeIP(s string) string {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// truncate drops invalid UTF-8 from s and shortens it to at most n bytes
+// without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	s = strings.ToValidUTF8(s, "")
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"authkit/serviceauth"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func incomingContext(service string, pairs ...string) context.Context {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(pairs...))
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("172.16.0.9"), Port: 40000}})
+	if service != "" {
+		ctx = serviceauth.NewContext(ctx, serviceauth.Identity{Service: service})
+	}
+	return ctx
+}
+
+func TestClientInfoFromContext(t *testing.T) {
+	trusted := []string{"gateway"}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		trusted []string
+		wantIP  string
+		wantUA  string
+	}{
+		{
+			name:    "trusted proxy forwards the client",
+			ctx:     incomingContext("gateway", forwardedForHeader, "203.0.113.7, 10.0.0.1", forwardedUserAgentHeader, "Firefox", userAgentHeader, "grpc-node"),
+			trusted: trusted,
+			wantIP:  "203.0.113.7",
+			wantUA:  "Firefox",
+		},
+		{
+			name:    "trusted proxy without forwarded address",
+			ctx:     incomingContext("gateway"),
+			trusted: trusted,
+			wantIP:  "",
+		},
+		{
+			name:    "untrusted caller cannot spoof its address",
+			ctx:     incomingContext("", forwardedForHeader, "203.0.113.7", userAgentHeader, "curl"),
+			trusted: trusted,
+			wantIP:  "172.16.0.9",
+			wantUA:  "curl",
+		},
+		{
+			name:    "other service is not a proxy",
+			ctx:     incomingContext("user-service", forwardedForHeader, "203.0.113.7"),
+			trusted: trusted,
+			wantIP:  "172.16.0.9",
+		},
+		{
+			name:    "malformed forwarded address",
+			ctx:     incomingContext("gateway", forwardedForHeader, strings.Repeat("x", 100)),
+			trusted: trusted,
+			wantIP:  "",
+		},
+		{
+			name:    "everyone trusted in development",
+			ctx:     incomingContext("", forwardedForHeader, "2001:db8::1"),
+			trusted: []string{serviceauth.AnyService},
+			wantIP:  "2001:db8::1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := clientInfoFromContext(tt.ctx, tt.trusted)
+			if info.ip != tt.wantIP {
+				t.Errorf("ip = %q, want %q", info.ip, tt.wantIP)
+			}
+			if info.userAgent != tt.wantUA {
+				t.Errorf("userAgent = %q, want %q", info.userAgent, tt.wantUA)
+			}
+		})
+	}
+}
+
+func TestTruncateKeepsValidUTF8(t *testing.T) {
+	s := strings.Repeat("é", 200)
+	got := truncate(s, maxUserAgentLength)
+	if len(got) > maxUserAgentLength || !utf8.ValidString(got) {
+		t.Errorf("truncate returned %d bytes, valid UTF-8: %v", len(got), utf8.ValidString(got))
+	}
+}
+
+func TestTruncateDropsInvalidUTF8(t *testing.T) {
+	if got := truncate("curl\xff/8.0", maxUserAgentLength); got != "curl/8.0" {
+		t.Errorf("truncate = %q, want %q", got, "curl/8.0")
+	}
+}
@@ -0,0 +1,531 @@
+package service
+
+import (
+	"auth-service/dto"
+	"auth-service/models"
+	"auth-service/repository"
+	userpb "auth-service/user-pb"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	grantAuthorizationCode = "authorization_code"
+	grantRefreshToken      = "refresh_token"
+	grantClientCredentials = "client_credentials"
+
+	scopeOpenID  = "openid"
+	scopeProfile = "profile"
+	scopeEmail   = "email"
+)
+
+var (
+	supportedGrantTypes = []string{grantAuthorizationCode, grantRefreshToken, grantClientCredentials}
+	standardScopes      = []string{scopeOpenID, scopeProfile, scopeEmail}
+)
+
+// OAuthError is an error response as defined by RFC 6749. The authorization
+// server endpoints return it as is; other errors become server_error.
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func oauthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// RegisterOAuthClient creates a client for a third-party application. Only
+// admins may register clients; the secret is returned once and never stored.
+func (s *authService) RegisterOAuthClient(ctx context.Context, spec *OAuthClientSpec) (*OAuthClientRegistration, error) {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !caller.hasRole(adminRole) {
+		return nil, status.Error(codes.PermissionDenied, "only admins may register OAuth clients")
+	}
+
+	grantTypes := spec.GrantTypes
+	if len(grantTypes) == 0 {
+		grantTypes = []string{grantAuthorizationCode, grantRefreshToken}
+	}
+	if err := s.validateOAuthClientSpec(spec, grantTypes); err != nil {
+		return nil, err
+	}
+
+	registration := &OAuthClientRegistration{ClientID: "client-" + strings.ReplaceAll(uuid.NewString(), "-", "")}
+	saveDto := &dto.SaveOAuthClient{
+		ID:           registration.ClientID,
+		Name:         spec.Name,
+		RedirectURIs: spec.RedirectURIs,
+		Scopes:       spec.Scopes,
+		GrantTypes:   grantTypes,
+		Public:       spec.Public,
+		CreatedBy:    caller.Subject,
+	}
+	if !spec.Public {
+		registration.ClientSecret = newClientSecret()
+		saveDto.SecretHash = hashOpaqueToken(registration.ClientSecret)
+	}
+
+	if err := s.oauth.SaveOAuthClient(ctx, saveDto); err != nil {
+		log.Printf("failed to save OAuth client: %v", err)
+		return nil, status.Error(codes.Internal, "failed to register OAuth client")
+	}
+
+	return registration, nil
+}
+
+func (s *authService) validateOAuthClientSpec(spec *OAuthClientSpec, grantTypes []string) error {
+	if spec.Name == "" {
+		return status.Error(codes.InvalidArgument, "client name is required")
+	}
+
+	for _, grantType := range grantTypes {
+		if !slices.Contains(supportedGrantTypes, grantType) {
+			return status.Errorf(codes.InvalidArgument, "unsupported grant type %q", grantType)
+		}
+	}
+	if spec.Public && slices.Contains(grantTypes, grantClientCredentials) {
+		return status.Error(codes.InvalidArgument, "public clients cannot use client credentials")
+	}
+
+	if slices.Contains(grantTypes, grantAuthorizationCode) && len(spec.RedirectURIs) == 0 {
+		return status.Error(codes.InvalidArgument, "at least one redirect uri is required")
+	}
+	for _, redirectURI := range spec.RedirectURIs {
+		u, err := url.Parse(redirectURI)
+		if err != nil || u.Scheme == "" || u.Host == "" || u.Fragment != "" || strings.ContainsAny(redirectURI, " ") {
+			return status.Errorf(codes.InvalidArgument, "invalid redirect uri %q", redirectURI)
+		}
+	}
+
+	for _, scope := range spec.Scopes {
+		if _, ok := s.config.OAuthScopeRoles[scope]; !ok && !slices.Contains(standardScopes, scope) {
+			return status.Errorf(codes.InvalidArgument, "unknown scope %q", scope)
+		}
+	}
+
+	return nil
+}
+
+// DeleteOAuthClient removes a client, ends every session granted to it and
+// denies the client credentials tokens it already holds.
+func (s *authService) DeleteOAuthClient(ctx context.Context, clientID string) error {
+	caller, err := s.authenticate(ctx)
+	if err != nil {
+		return err
+	}
+	if !caller.hasRole(adminRole) {
+		return status.Error(codes.PermissionDenied, "only admins may delete OAuth clients")
+	}
+
+	err = s.oauth.DeleteOAuthClient(ctx, clientID)
+	if errors.Is(err, repository.ErrEntityNotFound) {
+		return status.Error(codes.NotFound, "OAuth client not found")
+	} else if err != nil {
+		log.Printf("failed to delete OAuth client: %v", err)
+		return status.Error(codes.Internal, "failed to delete OAuth client")
+	}
+
+	filter := &dto.RevokeRefreshTokens{ClientID: clientID}
+	if _, err := s.repository.RevokeRefreshTokens(ctx, filter); err != nil {
+		log.Printf("failed to revoke sessions of OAuth client %s: %v", clientID, err)
+	}
+
+	// Client credentials tokens have no session; their subject is the client.
+	now := time.Now()
+	if err := s.denylist.DenyUser(ctx, clientID, now, now.Add(s.config.AccessTTL)); err != nil {
+		log.Printf("failed to deny access tokens of OAuth client %s: %v", clientID, err)
+	}
+	return nil
+}
+
+// Authorize handles an authorization request from a client on behalf of the
+// calling user. auth-service has no login pages, so the user's access token
+// must accompany the request. Errors about the client or its redirect URI are
+// returned as *OAuthError; everything else is reported to the client through
+// the redirect, as RFC 6749 requires.
+func (s *authService) Authorize(ctx context.Context, req *AuthorizeRequest) (*AuthorizeResult, error) {
+	client, err := s.oauth.GetOAuthClient(ctx, req.ClientID)
+	if errors.Is(err, repository.ErrEntityNotFound) {
+		return nil, oauthError("invalid_request", "unknown client")
+	} else if err != nil {
+		log.Printf("failed to get OAuth client: %v", err)
+		return nil, status.Error(codes.Internal, "failed to authorize")
+	}
+
+	redirectURIs := strings.Fields(client.RedirectURIs)
+	redirectURI := req.RedirectURI
+	if redirectURI == "" && len(redirectURIs) == 1 {
+		redirectURI = redirectURIs[0]
+	}
+	if !slices.Contains(redirectURIs, redirectURI) {
+		return nil, oauthError("invalid_request", "redirect uri is not registered for this client")
+	}
+
+	result := &AuthorizeResult{RedirectURI: redirectURI, Params: url.Values{}}
+	if req.State != "" {
+		result.Params.Set("state", req.State)
+	}
+	fail := func(code, description string) (*AuthorizeResult, error) {
+		result.Params.Set("error", code)
+		result.Params.Set("error_description", description)
+		return result, nil
+	}
+
+	if req.ResponseType != "code" {
+		return fail("unsupported_response_type", "only the code response type is supported")
+	}
+	if !hasField(client.GrantTypes, grantAuthorizationCode) {
+		return fail("unauthorized_client", "client may not use the authorization code grant")
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return fail("invalid_request", "a S256 code challenge is required")
+	}
+
+	scope, oauthErr := resolveScope(client, req.Scope)
+	if oauthErr != nil {
+		return fail(oauthErr.Code, oauthErr.Description)
+	}
+
+	caller, err := s.authenticateInteractive(ctx)
+	if status.Code(err) == codes.PermissionDenied {
+		return fail("access_denied", "only the user's own session can authorize clients")
+	} else if err != nil {
+		return nil, err
+	}
+
+	code, expiration := issueOpaqueToken(s.config.OAuthCodeTTL)
+	saveDto := &dto.SaveOAuthAuthorizationCode{
+		CodeHash:      hashOpaqueToken(code),
+		ClientID:      client.ID,
+		UserID:        caller.Subject,
+		RedirectURI:   redirectURI,
+		Scope:         scope,
+		CodeChallenge: req.CodeChallenge,
+		Nonce:         req.Nonce,
+		AuthTime:      caller.IssuedAt.Time,
+		Expiration:    expiration,
+	}
+	if err := s.oauth.SaveAuthorizationCode(ctx, saveDto); err != nil {
+		log.Printf("failed to save authorization code: %v", err)
+		return fail("server_error", "failed to issue authorization code")
+	}
+
+	result.Params.Set("code", code)
+	return result, nil
+}
+
+// IssueOAuthToken implements the token endpoint for the authorization code,
+// refresh token and client credentials grants.
+func (s *authService) IssueOAuthToken(ctx context.Context, req *TokenRequest) (*TokenResponse, error) {
+	client, err := s.authenticateOAuthClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if !hasField(client.GrantTypes, req.GrantType) {
+		if !slices.Contains(supportedGrantTypes, req.GrantType) {
+			return nil, oauthError("unsupported_grant_type", "unsupported grant type")
+		}
+		return nil, oauthError("unauthorized_client", "client may not use this grant type")
+	}
+
+	switch req.GrantType {
+	case grantAuthorizationCode:
+		return s.exchangeAuthorizationCode(ctx, client, req)
+	case grantRefreshToken:
+		return s.refreshOAuthSession(ctx, client, req)
+	default:
+		return s.issueClientCredentialsToken(client, req)
+	}
+}
+
+// authenticateOAuthClient checks the client's credentials. Failures count
+// towards the login guard so client secrets cannot be guessed at full speed.
+func (s *authService) authenticateOAuthClient(ctx context.Context, clientID, secret string) (*models.OAuthClient, error) {
+	ip := clientInfoFromContext(ctx, s.config.TrustedProxies).ip
+	if err := s.loginGuard.CheckClient(ctx, clientID, ip); err != nil {
+		return nil, err
+	}
+
+	client, err := s.oauth.GetOAuthClient(ctx, clientID)
+	if errors.Is(err, repository.ErrEntityNotFound) {
+		s.loginGuard.RecordClientFailure(ctx, clientID, ip)
+		return nil, oauthError("invalid_client", "client authentication failed")
+	} else if err != nil {
+		log.Printf("failed to get OAuth client: %v", err)
+		return nil, err
+	}
+
+	if client.Public {
+		if secret != "" {
+			return nil, oauthError("invalid_client", "public clients have no secret")
+		}
+		return client, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashOpaqueToken(secret)), []byte(client.SecretHash)) != 1 {
+		s.loginGuard.RecordClientFailure(ctx, clientID, ip)
+		return nil, oauthError("invalid_client", "client authentication failed")
+	}
+	return client, nil
+}
+
+func (s *authService) exchangeAuthorizationCode(ctx context.Context, client *models.OAuthClient, req *TokenRequest) (*TokenResponse, error) {
+	code, err := s.oauth.ConsumeAuthorizationCode(ctx, hashOpaqueToken(req.Code))
+	if errors.Is(err, repository.ErrEntityNotFound) {
+		return nil, oauthError("invalid_grant", "invalid authorization code")
+	} else if err != nil {
+		log.Printf("failed to get authorization code: %v", err)
+		return nil, err
+	}
+
+	switch {
+	case time.Now().After(code.ExpiresAt):
+		return nil, oauthError("invalid_grant", "authorization code expired")
+	case code.ClientID != client.ID:
+		return nil, oauthError("invalid_grant", "authorization code was issued to another client")
+	case req.RedirectURI != code.RedirectURI:
+		return nil, oauthError("invalid_grant", "redirect uri does not match the authorization request")
+	case !verifyCodeChallenge(req.CodeVerifier, code.CodeChallenge):
+		return nil, oauthError("invalid_grant", "invalid code verifier")
+	}
+
+	userRes, err := s.userService.GetUserById(ctx, &userpb.GetUserByIdRequest{Id: code.UserID})
+	if status.Code(err) == codes.NotFound {
+		return nil, oauthError("invalid_grant", "user no longer exists")
+	} else if err != nil {
+		log.Printf("failed to get user: %v", err)
+		return nil, err
+	}
+	user := userRes.GetUser()
+
+	grant := sessionGrant{clientID: client.ID, scope: code.Scope}
+	tokens, err := s.startSession(ctx, user, clientInfoFromContext(ctx, s.config.TrustedProxies), grant)
+	if err != nil {
+		return nil, err
+	}
+
+	res := s.tokenResponse(client, tokens, code.Scope)
+	if hasField(code.Scope, scopeOpenID) {
+		if res.IDToken, err = s.issueIDToken(user, client.ID, code); err != nil {
+			log.Printf("failed to sign id token: %v", err)
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (s *authService) refreshOAuthSession(ctx context.Context, client *models.OAuthClient, req *TokenRequest) (*TokenResponse, error) {
+	tokenHash := s.hashRefreshToken(req.RefreshToken)
+	token, err := s.repository.GetRefreshToken(ctx, tokenHash)
+	if errors.Is(err, repository.ErrEntityNotFound) {
+		return nil, oauthError("invalid_grant", "invalid refresh token")
+	} else if err != nil {
+		log.Printf("failed to get refresh token: %v", err)
+		return nil, err
+	}
+
+	if token.ClientID != client.ID {
+		return nil, oauthError("invalid_grant", "invalid refresh token")
+	}
+	for _, scope := range strings.Fields(req.Scope) {
+		if !hasField(token.Scope, scope) {
+			return nil, oauthError("invalid_scope", "scope exceeds the original grant")
+		}
+	}
+
+	tokens, err := s.rotateSession(ctx, token, tokenHash)
+	if status.Code(err) == codes.Unauthenticated {
+		return nil, oauthError("invalid_grant", status.Convert(err).Message())
+	} else if err != nil {
+		return nil, err
+	}
+
+	return s.tokenResponse(client, tokens, token.Scope), nil
+}
+
+func (s *authService) issueClientCredentialsToken(client *models.OAuthClient, req *TokenRequest) (*TokenResponse, error) {
+	scope, oauthErr := resolveScope(client, req.Scope)
+	if oauthErr != nil {
+		return nil, oauthErr
+	}
+
+	claims := &claims{
+		userId:   client.ID,
+		username: client.Name,
+		roles:    s.scopeRoles(scope),
+		scope:    scope,
+		clientId: client.ID,
+	}
+	access, accessExp, err := issueJwtToken(claims, s.config.AccessTTL, s.keyring.SigningKey())
+	if err != nil {
+		log.Printf("failed to sign access token: %v", err)
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken: access,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(time.Until(accessExp).Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+// tokenResponse leaves out the refresh token for clients that may not use it;
+// the session still exists so that it can be listed and revoked.
+func (s *authService) tokenResponse(client *models.OAuthClient, tokens *Tokens, scope string) *TokenResponse {
+	res := &TokenResponse{
+		AccessToken: tokens.Access,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(time.Until(tokens.AccessExp).Seconds()),
+		Scope:       scope,
+	}
+	if hasField(client.GrantTypes, grantRefreshToken) {
+		res.RefreshToken = tokens.Refresh
+	}
+	return res
+}
+
+func (s *authService) issueIDToken(user *userpb.User, clientID string, code *models.OAuthAuthorizationCode) (string, error) {
+	now := time.Now()
+	claims := idTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.config.OAuthIssuer,
+			Subject:   user.Id,
+			Audience:  jwt.ClaimStrings{clientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.config.AccessTTL)),
+		},
+		Nonce:    code.Nonce,
+		AuthTime: code.AuthTime.Unix(),
+	}
+	if hasField(code.Scope, scopeProfile) {
+		claims.Name = user.Name
+		claims.PreferredUsername = user.Username
+	}
+	if hasField(code.Scope, scopeEmail) {
+		claims.Email = user.Email
+	}
+
+	key := s.keyring.SigningKey()
+	t := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	t.Header["kid"] = key.ID
+	return t.SignedString(key.Key)
+}
+
+// OpenIDConfiguration returns the discovery document served at
+// /.well-known/openid-configuration.
+func (s *authService) OpenIDConfiguration() *OpenIDConfiguration {
+	issuer := s.config.OAuthIssuer
+
+	scopes := slices.Clone(standardScopes)
+	for scope := range s.config.OAuthScopeRoles {
+		scopes = append(scopes, scope)
+	}
+	slices.Sort(scopes)
+
+	var algorithms []string
+	for _, key := range s.keyring.PublicKeys() {
+		if !slices.Contains(algorithms, key.Alg) {
+			algorithms = append(algorithms, key.Alg)
+		}
+	}
+
+	return &OpenIDConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/authorize",
+		TokenEndpoint:                     issuer + "/token",
+		JwksURI:                           issuer + "/jwks",
+		ScopesSupported:                   scopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               supportedGrantTypes,
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  algorithms,
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+	}
+}
+
+// rolesForScope narrows the user's roles to those unlocked by the scope.
+func (s *authService) rolesForScope(scope string, userRoles []string) []string {
+	var roles []string
+	for _, role := range s.scopeRoles(scope) {
+		if slices.Contains(userRoles, role) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+func (s *authService) scopeRoles(scope string) []string {
+	var roles []string
+	for _, field := range strings.Fields(scope) {
+		role, ok := s.config.OAuthScopeRoles[field]
+		if ok && !slices.Contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// resolveScope checks the requested scope against the client's registration.
+// An empty request is granted everything the client is registered for.
+func resolveScope(client *models.OAuthClient, requested string) (string, *OAuthError) {
+	if requested == "" {
+		return client.Scopes, nil
+	}
+
+	var granted []string
+	for _, scope := range strings.Fields(requested) {
+		if !hasField(client.Scopes, scope) {
+			return "", oauthError("invalid_scope", "scope "+scope+" is not allowed for this client")
+		}
+		if !slices.Contains(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+	return strings.Join(granted, " "), nil
+}
+
+func verifyCodeChallenge(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// hasField reports whether the space separated list contains value.
+func hasField(list, value string) bool {
+	return slices.Contains(strings.Fields(list), value)
+}
+
+func newClientSecret() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"auth-service/models"
+	userpb "auth-service/user-pb"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newOAuthTestService(t *testing.T, clients ...models.OAuthClient) *authService {
+	t.Helper()
+
+	oauth := &fakeOAuthRepository{clients: make(map[string]models.OAuthClient)}
+	for _, client := range clients {
+		oauth.clients[client.ID] = client
+	}
+
+	return &authService{
+		repository: &fakeAuthRepository{},
+		denylist:   &fakeDenylistRepository{},
+		oauth:      oauth,
+		loginGuard: newTestLoginGuard(),
+		config:     newTestConfig(),
+		keyring:    newTestKeyring(t),
+	}
+}
+
+func TestVerifyAccessTokenRejectsIDTokens(t *testing.T) {
+	s := newOAuthTestService(t)
+	user := &userpb.User{Id: "alice", Username: "alice"}
+
+	idToken, err := s.issueIDToken(user, "client-1", &models.OAuthAuthorizationCode{Scope: "openid profile", AuthTime: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.verifyAccessToken(context.Background(), idToken); !errors.Is(err, errInactiveToken) {
+		t.Errorf("ID token accepted as an access token: %v", err)
+	}
+
+	access := issueTestAccessToken(t, s, &claims{userId: user.Id, username: user.Username, sessionId: "session"})
+	if _, err := s.verifyAccessToken(context.Background(), access); err != nil {
+		t.Errorf("access token rejected: %v", err)
+	}
+}
+
+func TestDeleteOAuthClientDeniesClientCredentialsTokens(t *testing.T) {
+	client := models.OAuthClient{ID: "client-1", Name: "reporting", GrantTypes: grantClientCredentials}
+	s := newOAuthTestService(t, client)
+
+	res, err := s.issueClientCredentialsToken(&client, &TokenRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.verifyAccessToken(context.Background(), res.AccessToken); err != nil {
+		t.Fatalf("client credentials token rejected before deletion: %v", err)
+	}
+
+	admin := issueTestAccessToken(t, s, &claims{userId: "admin", username: "admin", roles: []string{adminRole}, sessionId: "admin-session"})
+	if err := s.DeleteOAuthClient(withBearer(context.Background(), admin), client.ID); err != nil {
+		t.Fatalf("DeleteOAuthClient: %v", err)
+	}
+
+	if _, err := s.verifyAccessToken(context.Background(), res.AccessToken); !errors.Is(err, errInactiveToken) {
+		t.Errorf("client credentials token still accepted after deletion: %v", err)
+	}
+	if _, err := s.verifyAccessToken(context.Background(), admin); err != nil {
+		t.Errorf("deleting the client affected the admin: %v", err)
+	}
+}
+
+func TestIssueOAuthTokenThrottlesClientSecretGuesses(t *testing.T) {
+	client := models.OAuthClient{ID: "client-1", SecretHash: hashOpaqueToken("secret"), GrantTypes: grantClientCredentials}
+	s := newOAuthTestService(t, client)
+	ctx := context.Background()
+
+	for range 3 {
+		_, err := s.IssueOAuthToken(ctx, &TokenRequest{GrantType: grantClientCredentials, ClientID: client.ID, ClientSecret: "guess"})
+		var oauthErr *OAuthError
+		if !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_client" {
+			t.Fatalf("wrong secret: got %v, want invalid_client", err)
+		}
+	}
+
+	_, err := s.IssueOAuthToken(ctx, &TokenRequest{GrantType: grantClientCredentials, ClientID: client.ID, ClientSecret: "secret"})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("after repeated failures: got %v, want ResourceExhausted", err)
+	}
+}
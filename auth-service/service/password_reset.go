@@ -0,0 +1,114 @@
+package service
+
+import (
+	"auth-service/dto"
+	"auth-service/notify"
+	"auth-service/repository"
+	userpb "auth-service/user-pb"
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RequestPasswordReset sends a single-use reset token to the user. It reports
+// success for unknown usernames too, so it cannot be used to probe accounts.
+func (s *authService) RequestPasswordReset(ctx context.Context, username string) error {
+	client := clientInfoFromContext(ctx, s.config.TrustedProxies)
+	if err := s.loginGuard.AllowPasswordReset(ctx, username, client.ip); err != nil {
+		return err
+	}
+
+	userRes, err := s.userService.GetUserByUsername(ctx, &userpb.GetUserByUsernameRequest{Username: username})
+	if status.Code(err) == codes.NotFound {
+		return nil
+	} else if err != nil {
+		log.Printf("failed to get user: %v", err)
+		return status.Error(codes.Internal, "failed to request password reset")
+	}
+	user := userRes.GetUser()
+
+	token, expiration := issueOpaqueToken(s.config.PasswordResetTTL)
+	saveDto := &dto.SavePasswordResetToken{
+		TokenHash:  hashOpaqueToken(token),
+		UserID:     user.Id,
+		Expiration: expiration,
+	}
+	if err := s.passwordResets.SavePasswordResetToken(ctx, saveDto); err != nil {
+		log.Printf("failed to save password reset token: %v", err)
+		return status.Error(codes.Internal, "failed to request password reset")
+	}
+
+	msg := &notify.PasswordResetMessage{
+		UserID:    user.Id,
+		Username:  user.Username,
+		Token:     token,
+		ExpiresAt: expiration,
+	}
+	if err := s.notifier.SendPasswordReset(ctx, msg); err != nil {
+		log.Printf("failed to send password reset: %v", err)
+		return status.Error(codes.Internal, "failed to request password reset")
+	}
+
+	return nil
+}
+
+// ConfirmPasswordReset sets a new password using a reset token and signs the
+// user out everywhere, since whoever held the old password may be logged in.
+func (s *authService) ConfirmPasswordReset(ctx context.Context, token, newPassword string) error {
+	if newPassword == "" {
+		return status.Error(codes.InvalidArgument, "new password is required")
+	}
+
+	tokenHash := hashOpaqueToken(token)
+	resetToken, err := s.passwordResets.GetPasswordResetToken(ctx, tokenHash)
+	if errors.Is(err, repository.ErrEntityNotFound) {
+		return status.Error(codes.Unauthenticated, "invalid password reset token")
+	} else if err != nil {
+		log.Printf("failed to get password reset token: %v", err)
+		return status.Error(codes.Internal, "failed to reset password")
+	}
+
+	if resetToken.UsedAt != nil {
+		return status.Error(codes.Unauthenticated, "invalid password reset token")
+	}
+	if time.Now().After(resetToken.ExpiresAt) {
+		return status.Error(codes.Unauthenticated, "password reset token expired")
+	}
+
+	// The token is only used up once the password is set, so a password the
+	// policy rejects does not cost the user their reset link.
+	setReq := &userpb.SetPasswordRequest{UserId: resetToken.UserID, Password: newPassword}
+	if _, err := s.userService.SetPassword(ctx, setReq); status.Code(err) == codes.InvalidArgument {
+		return err
+	} else if err != nil {
+		log.Printf("failed to set password: %v", err)
+		return status.Error(codes.Internal, "failed to reset password")
+	}
+
+	// Losing this race means a concurrent request with the same token set a
+	// password too; both came from the token holder, so carry on.
+	if _, err := s.passwordResets.ConsumePasswordResetToken(ctx, tokenHash); err != nil && !errors.Is(err, repository.ErrAlreadyUsed) {
+		log.Printf("failed to consume password reset token: %v", err)
+	}
+
+	s.revokeUserCredentials(ctx, resetToken.UserID)
+	return nil
+}
+
+// revokeUserCredentials ends every session of the user and invalidates the
+// access tokens already issued to them.
+func (s *authService) revokeUserCredentials(ctx context.Context, userID string) {
+	filter := &dto.RevokeRefreshTokens{UserID: userID}
+	if _, err := s.repository.RevokeRefreshTokens(ctx, filter); err != nil {
+		log.Printf("failed to revoke refresh tokens of user %s: %v", userID, err)
+	}
+
+	now := time.Now()
+	if err := s.denylist.DenyUser(ctx, userID, now, now.Add(s.config.AccessTTL)); err != nil {
+		log.Printf("failed to deny access tokens of user %s: %v", userID, err)
+	}
+}
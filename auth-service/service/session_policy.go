@@ -0,0 +1,84 @@
+package service
+
+import (
+	"auth-service/dto"
+	"auth-service/models"
+	"context"
+	"log"
+	"slices"
+	"time"
+)
+
+const securityEventSessionEvicted = "session_evicted"
+
+// sessionGrant describes how a new session was granted. Sessions granted to
+// an OAuth client carry its ID and the scope the user consented to.
+type sessionGrant struct {
+	rememberMe bool
+	clientID   string
+	scope      string
+}
+
+// refreshTTL is how long a refresh token issued now may live for a session
+// started at startedAt: the configured refresh TTL, cut short so the session
+// never outlives its absolute lifetime. A non-positive result means the
+// session is over.
+func (s *authService) refreshTTL(startedAt time.Time, rememberMe bool) time.Duration {
+	ttl := s.config.RefreshTTL
+	if rememberMe {
+		ttl = s.config.RememberMeRefreshTTL
+	}
+
+	remaining := time.Until(startedAt.Add(s.config.SessionMaxLifetime))
+	return min(ttl, remaining)
+}
+
+// enforceSessionLimit revokes the user's oldest sessions once they hold more
+// than the configured maximum, never touching the session just started.
+// Failures are logged: the new session is already valid either way.
+func (s *authService) enforceSessionLimit(ctx context.Context, userID, currentFamilyID string) {
+	limit := s.config.MaxSessionsPerUser
+	if limit <= 0 {
+		return
+	}
+
+	tokens, err := s.repository.ListActiveRefreshTokens(ctx, userID)
+	if err != nil {
+		log.Printf("failed to list sessions of user %s: %v", userID, err)
+		return
+	}
+	if len(tokens) <= limit {
+		return
+	}
+
+	slices.SortFunc(tokens, func(a, b models.RefreshToken) int {
+		return a.SessionStartedAt.Compare(b.SessionStartedAt)
+	})
+
+	excess := len(tokens) - limit
+	for _, token := range tokens {
+		if excess == 0 {
+			break
+		}
+		if token.FamilyID == currentFamilyID {
+			continue
+		}
+
+		filter := &dto.RevokeRefreshTokens{FamilyID: token.FamilyID}
+		if _, err := s.repository.RevokeRefreshTokens(ctx, filter); err != nil {
+			log.Printf("failed to evict session %s: %v", token.FamilyID, err)
+			continue
+		}
+		excess--
+
+		event := &dto.SaveSecurityEvent{
+			Type:     securityEventSessionEvicted,
+			UserID:   userID,
+			FamilyID: token.FamilyID,
+			Details:  "session limit exceeded; oldest session revoked",
+		}
+		if err := s.repository.SaveSecurityEvent(ctx, event); err != nil {
+			log.Printf("failed to record security event: %v", err)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package service
 
 import (
+	"net/url"
+	"slices"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -13,15 +15,200 @@ type Tokens struct {
 	RefreshExp time.Time
 }
 
+// LoginResult carries either tokens or, for users with two-factor
+// authentication, a challenge to be completed with VerifySecondFactor.
+type LoginResult struct {
+	Tokens    *Tokens
+	Challenge *LoginChallenge
+}
+
+type LoginChallenge struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+type FederatedLoginRedirect struct {
+	URL       string
+	State     string
+	ExpiresAt time.Time
+}
+
+type TotpEnrollment struct {
+	Secret          string
+	ProvisioningURI string
+}
+
+type Session struct {
+	ID         string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+	ClientIP   string
+	UserAgent  string
+}
+
+type Introspection struct {
+	Active    bool
+	Subject   string
+	Username  string
+	ActorID   string
+	ClientID  string
+	APIKeyID  string
+	Roles     []string
+	SessionID string
+	TokenID   string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+
+	Permissions []string
+}
+
+type JsonWebKey struct {
+	Kty string
+	Kid string
+	Use string
+	Alg string
+	N   string
+	E   string
+	Crv string
+	X   string
+}
+
 type claims struct {
-	userId   string
-	username string
-	roles    []string
+	userId    string
+	username  string
+	roles     []string
+	sessionId string
+	scope     string
+	clientId  string
+	apiKeyId  string
+	actor     *actorClaim
+
+	permissions []string
 }
 
 type jwtClaims struct {
 	jwt.RegisteredClaims
 
-	Username string
-	Roles    []string
+	Username  string
+	Roles     []string
+	SessionID string
+	// Permissions granted by Roles, so services can authorize locally.
+	Permissions []string `json:"permissions,omitempty"`
+	// Set on tokens issued to OAuth clients.
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	// Set on tokens exchanged for an API key.
+	APIKeyID string `json:"api_key_id,omitempty"`
+	// Set on impersonation tokens: the admin acting as the subject.
+	Actor *actorClaim `json:"act,omitempty"`
+}
+
+// actorClaim is the act claim of RFC 8693.
+type actorClaim struct {
+	Subject  string `json:"sub"`
+	Username string `json:"username,omitempty"`
+}
+
+func (c *jwtClaims) hasRole(role string) bool {
+	return slices.Contains(c.Roles, role)
+}
+
+type APIKeySpec struct {
+	OwnerID   string
+	Name      string
+	Roles     []string
+	ExpiresAt *time.Time
+}
+
+type APIKey struct {
+	ID         string
+	Name       string
+	Prefix     string
+	OwnerID    string
+	Roles      []string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	ExpiresAt  *time.Time
+}
+
+// CreatedAPIKey holds the raw key, which is only available at creation.
+type CreatedAPIKey struct {
+	Key string
+	APIKey
+}
+
+type OAuthClientSpec struct {
+	Name         string
+	RedirectURIs []string
+	Scopes       []string
+	GrantTypes   []string
+	Public       bool
+}
+
+type OAuthClientRegistration struct {
+	ClientID     string
+	ClientSecret string
+}
+
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// AuthorizeResult is where the user agent is sent back to, with either the
+// authorization code or an error in Params.
+type AuthorizeResult struct {
+	RedirectURI string
+	Params      url.Values
+}
+
+type TokenRequest struct {
+	GrantType    string
+	ClientID     string
+	ClientSecret string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+	Scope        string
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	JwksURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+
+	Nonce             string `json:"nonce,omitempty"`
+	AuthTime          int64  `json:"auth_time"`
+	Name              string `json:"name,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Email             string `json:"email,omitempty"`
 }
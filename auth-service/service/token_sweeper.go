@@ -0,0 +1,89 @@
+package service
+
+import (
+	"auth-service/config"
+	"auth-service/metrics"
+	"auth-service/repository"
+	"context"
+	"log"
+	"time"
+)
+
+const tokenSweeperLease = "refresh-token-sweeper"
+
+// TokenSweeper deletes refresh tokens that can no longer be used. Replicas
+// compete for a lease so that only one of them sweeps at a time.
+type TokenSweeper struct {
+	repository repository.AuthRepository
+	leases     repository.LeaseRepository
+	holder     string
+
+	interval  time.Duration
+	batchSize int
+}
+
+func NewTokenSweeper(repository repository.AuthRepository, leases repository.LeaseRepository, cfg *config.Config) *TokenSweeper {
+	return &TokenSweeper{
+		repository: repository,
+		leases:     leases,
+		holder:     newLeaseHolderID(),
+		interval:   cfg.RefreshTokenGCInterval,
+		batchSize:  cfg.RefreshTokenGCBatchSize,
+	}
+}
+
+// Run sweeps on every interval until ctx is done.
+func (t *TokenSweeper) Run(ctx context.Context) {
+	if t.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.sweep(ctx)
+		}
+	}
+}
+
+func (t *TokenSweeper) sweep(ctx context.Context) {
+	// The lease outlives one interval so the leader keeps it between sweeps,
+	// and a crashed leader is replaced within two.
+	leader, err := t.leases.AcquireLease(ctx, tokenSweeperLease, t.holder, t.interval+t.interval/2)
+	if err != nil {
+		log.Printf("failed to acquire refresh token sweeper lease: %v", err)
+		metrics.RefreshTokenSweeps.WithLabelValues("error").Inc()
+		return
+	}
+	if !leader {
+		metrics.RefreshTokenSweeperLeader.Set(0)
+		return
+	}
+	metrics.RefreshTokenSweeperLeader.Set(1)
+
+	var total int64
+	for ctx.Err() == nil {
+		purged, err := t.repository.PurgeRefreshTokens(ctx, t.batchSize)
+		total += purged
+		metrics.RefreshTokensPurged.Add(float64(purged))
+
+		if err != nil {
+			log.Printf("failed to purge refresh tokens: %v", err)
+			metrics.RefreshTokenSweeps.WithLabelValues("error").Inc()
+			return
+		}
+		if purged < int64(t.batchSize) {
+			break
+		}
+	}
+
+	metrics.RefreshTokenSweeps.WithLabelValues("success").Inc()
+	if total > 0 {
+		log.Printf("purged %d refresh tokens", total)
+	}
+}
@@ -0,0 +1,360 @@
+package service
+
+import (
+	"auth-service/dto"
+	"auth-service/repository"
+	userpb "auth-service/user-pb"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	totpPeriod           = 30
+	totpSkew             = 1
+	recoveryCodeCount    = 10
+	maxChallengeAttempts = 5
+)
+
+var totpOpts = totp.ValidateOpts{
+	Period:    totpPeriod,
+	Digits:    otp.DigitsSix,
+	Algorithm: otp.AlgorithmSHA1,
+}
+
+// BeginTotpEnrollment generates a new TOTP secret for the caller. It only
+// takes effect once confirmed with a code from the authenticator app.
+func (s *authService) BeginTotpEnrollment(ctx context.Context) (*TotpEnrollment, error) {
+	caller, err := s.authenticateInteractive(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.twoFactor.GetTwoFactor(ctx, caller.Subject)
+	if err != nil && !errors.Is(err, repository.ErrEntityNotFound) {
+		log.Printf("failed to get two-factor settings: %v", err)
+		return nil, status.Error(codes.Internal, "failed to start enrollment")
+	}
+	if existing != nil && existing.ConfirmedAt != nil {
+		return nil, status.Error(codes.FailedPrecondition, "two-factor authentication is already enabled")
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      s.config.TotpIssuer,
+		AccountName: caller.Username,
+		Period:      totpPeriod,
+		Digits:      totpOpts.Digits,
+		Algorithm:   totpOpts.Algorithm,
+	})
+	if err != nil {
+		log.Printf("failed to generate totp secret: %v", err)
+		return nil, status.Error(codes.Internal, "failed to start enrollment")
+	}
+
+	sealedSecret, err := sealTotpSecret(s.config.TotpEncryptionKey, caller.Subject, key.Secret())
+	if err != nil {
+		log.Printf("failed to seal totp secret: %v", err)
+		return nil, status.Error(codes.Internal, "failed to start enrollment")
+	}
+
+	if err := s.twoFactor.SaveTwoFactor(ctx, caller.Subject, sealedSecret); err != nil {
+		log.Printf("failed to save totp secret: %v", err)
+		return nil, status.Error(codes.Internal, "failed to start enrollment")
+	}
+
+	return &TotpEnrollment{
+		Secret:          key.Secret(),
+		ProvisioningURI: key.URL(),
+	}, nil
+}
+
+// ConfirmTotpEnrollment enables two-factor authentication once the caller
+// proves their authenticator works, and returns single-use recovery codes that
+// are shown exactly once.
+func (s *authService) ConfirmTotpEnrollment(ctx context.Context, code string) ([]string, error) {
+	caller, err := s.authenticateInteractive(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	twoFactor, err := s.twoFactor.GetTwoFactor(ctx, caller.Subject)
+	if errors.Is(err, repository.ErrEntityNotFound) {
+		return nil, status.Error(codes.FailedPrecondition, "no two-factor enrollment in progress")
+	} else if err != nil {
+		log.Printf("failed to get two-factor settings: %v", err)
+		return nil, status.Error(codes.Internal, "failed to confirm enrollment")
+	}
+	if twoFactor.ConfirmedAt != nil {
+		return nil, status.Error(codes.FailedPrecondition, "two-factor authentication is already enabled")
+	}
+
+	secret, err := openTotpSecret(s.config.TotpEncryptionKey, caller.Subject, twoFactor.Secret)
+	if err != nil {
+		log.Printf("failed to open totp secret: %v", err)
+		return nil, status.Error(codes.Internal, "failed to confirm enrollment")
+	}
+
+	if _, ok := matchTotpCode(secret, code, time.Now()); !ok {
+		return nil, status.Error(codes.InvalidArgument, "invalid code")
+	}
+
+	recoveryCodes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range recoveryCodes {
+		recoveryCodes[i] = newRecoveryCode()
+		hashes[i] = hashOpaqueToken(normalizeRecoveryCode(recoveryCodes[i]))
+	}
+
+	if err := s.twoFactor.ConfirmTwoFactor(ctx, caller.Subject, hashes); err != nil {
+		log.Printf("failed to confirm two-factor enrollment: %v", err)
+		return nil, status.Error(codes.Internal, "failed to confirm enrollment")
+	}
+
+	return recoveryCodes, nil
+}
+
+// DisableTotp turns two-factor authentication off for the caller, who must
+// present a current TOTP code or an unused recovery code to do so.
+func (s *authService) DisableTotp(ctx context.Context, code string) error {
+	caller, err := s.authenticateInteractive(ctx)
+	if err != nil {
+		return err
+	}
+
+	twoFactor, err := s.twoFactor.GetTwoFactor(ctx, caller.Subject)
+	if err != nil && !errors.Is(err, repository.ErrEntityNotFound) {
+		log.Printf("failed to get two-factor settings: %v", err)
+		return status.Error(codes.Internal, "failed to disable two-factor authentication")
+	}
+	if twoFactor == nil || twoFactor.ConfirmedAt == nil {
+		return status.Error(codes.FailedPrecondition, "two-factor authentication is not enabled")
+	}
+
+	// Codes are throttled like logins so a stolen access token cannot be
+	// used to guess its way past the second factor.
+	client := clientInfoFromContext(ctx, s.config.TrustedProxies)
+	if err := s.loginGuard.Check(ctx, caller.Username, client.ip); err != nil {
+		return err
+	}
+	if err := s.checkSecondFactor(ctx, caller.Subject, code); err != nil {
+		if status.Code(err) == codes.Unauthenticated {
+			s.loginGuard.RecordFailure(ctx, caller.Username, client.ip)
+		}
+		return err
+	}
+
+	if err := s.twoFactor.DeleteTwoFactor(ctx, caller.Subject); err != nil {
+		log.Printf("failed to delete two-factor settings: %v", err)
+		return status.Error(codes.Internal, "failed to disable two-factor authentication")
+	}
+
+	return nil
+}
+
+// VerifySecondFactor completes a login that was paused for a second factor.
+// The code may be a TOTP code or one of the user's recovery codes.
+func (s *authService) VerifySecondFactor(ctx context.Context, challengeToken, code string) (*Tokens, error) {
+	challenge, err := s.twoFactor.GetLoginChallenge(ctx, hashOpaqueToken(challengeToken))
+	if errors.Is(err, repository.ErrEntityNotFound) {
+		return nil, status.Error(codes.Unauthenticated, "challenge not found")
+	} else if err != nil {
+		log.Printf("failed to get login challenge: %v", err)
+		return nil, status.Error(codes.Internal, "failed to verify second factor")
+	}
+
+	if time.Now().After(challenge.ExpiresAt) {
+		return nil, status.Error(codes.Unauthenticated, "challenge expired")
+	}
+
+	client := clientInfoFromContext(ctx, s.config.TrustedProxies)
+	if err := s.loginGuard.Check(ctx, challenge.Username, client.ip); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkSecondFactor(ctx, challenge.UserID, code); err != nil {
+		if status.Code(err) != codes.Unauthenticated {
+			return nil, err
+		}
+
+		s.loginGuard.RecordFailure(ctx, challenge.Username, client.ip)
+		if challenge.Attempts+1 >= maxChallengeAttempts {
+			err = s.twoFactor.DeleteLoginChallenge(ctx, challenge.ID)
+		} else {
+			err = s.twoFactor.IncrementLoginChallengeAttempts(ctx, challenge.ID)
+		}
+		if err != nil {
+			log.Printf("failed to update login challenge: %v", err)
+		}
+		return nil, status.Error(codes.Unauthenticated, "invalid code")
+	}
+
+	// Deleting the challenge is what makes it single-use; losing that race
+	// means another request already completed this login.
+	if err := s.twoFactor.DeleteLoginChallenge(ctx, challenge.ID); errors.Is(err, repository.ErrEntityNotFound) {
+		return nil, status.Error(codes.Unauthenticated, "challenge not found")
+	} else if err != nil {
+		log.Printf("failed to delete login challenge: %v", err)
+		return nil, status.Error(codes.Internal, "failed to verify second factor")
+	}
+	s.loginGuard.RecordSuccess(ctx, challenge.Username)
+
+	userRes, err := s.userService.GetUserById(ctx, &userpb.GetUserByIdRequest{Id: challenge.UserID})
+	if err != nil {
+		log.Printf("failed to get user: %v", err)
+		return nil, status.Error(codes.Unauthenticated, "failed to verify second factor")
+	}
+
+	return s.startSession(ctx, userRes.GetUser(), client, sessionGrant{rememberMe: challenge.RememberMe})
+}
+
+func (s *authService) checkSecondFactor(ctx context.Context, userID, code string) error {
+	twoFactor, err := s.twoFactor.GetTwoFactor(ctx, userID)
+	if err != nil {
+		log.Printf("failed to get two-factor settings: %v", err)
+		return status.Error(codes.Internal, "failed to verify second factor")
+	}
+
+	secret, err := openTotpSecret(s.config.TotpEncryptionKey, userID, twoFactor.Secret)
+	if err != nil {
+		log.Printf("failed to open totp secret: %v", err)
+		return status.Error(codes.Internal, "failed to verify second factor")
+	}
+
+	if step, ok := matchTotpCode(secret, code, time.Now()); ok {
+		err := s.twoFactor.UseTotpStep(ctx, userID, step)
+		if errors.Is(err, repository.ErrAlreadyUsed) {
+			return status.Error(codes.Unauthenticated, "code already used")
+		} else if err != nil {
+			log.Printf("failed to record totp use: %v", err)
+			return status.Error(codes.Internal, "failed to verify second factor")
+		}
+		return nil
+	}
+
+	err = s.twoFactor.UseRecoveryCode(ctx, userID, hashOpaqueToken(normalizeRecoveryCode(code)))
+	if errors.Is(err, repository.ErrEntityNotFound) {
+		return status.Error(codes.Unauthenticated, "invalid code")
+	} else if err != nil {
+		log.Printf("failed to use recovery code: %v", err)
+		return status.Error(codes.Internal, "failed to verify second factor")
+	}
+	return nil
+}
+
+// issueLoginChallenge parks a password-verified login until the second factor
+// is presented.
+func (s *authService) issueLoginChallenge(ctx context.Context, userID, username string, rememberMe bool) (*LoginChallenge, error) {
+	token, expiration := issueOpaqueToken(s.config.LoginChallengeTTL)
+
+	saveDto := &dto.SaveLoginChallenge{
+		TokenHash:  hashOpaqueToken(token),
+		UserID:     userID,
+		Username:   username,
+		RememberMe: rememberMe,
+		Expiration: expiration,
+	}
+	if err := s.twoFactor.SaveLoginChallenge(ctx, saveDto); err != nil {
+		log.Printf("failed to save login challenge: %v", err)
+		return nil, status.Error(codes.Internal, "could not login")
+	}
+
+	return &LoginChallenge{Token: token, ExpiresAt: expiration}, nil
+}
+
+// matchTotpCode returns the time step whose code matches, allowing for one
+// step of clock drift either way.
+func matchTotpCode(secret, code string, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != int(totpOpts.Digits) {
+		return 0, false
+	}
+
+	for offset := -totpSkew; offset <= totpSkew; offset++ {
+		t := now.Add(time.Duration(offset*totpPeriod) * time.Second)
+		expected, err := totp.GenerateCodeCustom(secret, t, totpOpts)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return t.Unix() / totpPeriod, true
+		}
+	}
+
+	return 0, false
+}
+
+// sealTotpSecret encrypts a TOTP secret for storage. Unlike recovery codes
+// the secret cannot be hashed, since codes are derived from it; the user ID is
+// bound in so a sealed secret cannot be moved to another account.
+func sealTotpSecret(key []byte, userID, secret string) (string, error) {
+	aead, err := newTotpAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	sealed := aead.Seal(nonce, nonce, []byte(secret), []byte(userID))
+	return base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+func openTotpSecret(key []byte, userID, sealed string) (string, error) {
+	aead, err := newTotpAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.RawStdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < aead.NonceSize() {
+		return "", errors.New("sealed totp secret is too short")
+	}
+
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	secret, err := aead.Open(nil, nonce, ciphertext, []byte(userID))
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+func newTotpAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func newRecoveryCode() string {
+	b := make([]byte, 10)
+	rand.Read(b)
+	code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+	return code[:5] + "-" + code[5:10] + "-" + code[10:15]
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+func hashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,102 @@
+package authclient
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"authkit/serviceauth"
+)
+
+// Rule says who may call an RPC. A caller matching any of its clauses is let
+// through; with only Services set, users cannot call the method at all.
+type Rule struct {
+	// Public methods need no access token.
+	Public bool
+	// Services may call the method without an access token, as identified
+	// by serviceauth.
+	Services []string
+	// Authenticated lets through any user with a valid access token.
+	Authenticated bool
+	// Roles lets through users holding any of these roles.
+	Roles []string
+	// Permissions lets through users granted any of these permissions.
+	Permissions []string
+	// Self lets through the user the request is about, whose id it returns.
+	Self func(req any) string
+}
+
+// AccessPolicy maps RPCs to rules, keyed like serviceauth.Policy by full
+// method name or by "/pkg.Service/*". Methods missing from it are denied.
+type AccessPolicy map[string]Rule
+
+func (p AccessPolicy) rule(fullMethod string) (Rule, bool) {
+	rule, ok := p[fullMethod]
+	if !ok {
+		serviceName, _, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+		rule, ok = p["/"+serviceName+"/*"]
+	}
+	return rule, ok
+}
+
+// UnaryServerInterceptor enforces policy before handlers run. Claims of
+// authorized users are stored on the context, where Authenticate finds them
+// without introspecting the token again.
+//
+// When service authentication is disabled there is no service identity to
+// check, so trustServices lets calls without an access token through to any
+// method open to services. It is only meant for local development.
+func (c *Client) UnaryServerInterceptor(policy AccessPolicy, trustServices bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := c.authorize(ctx, policy, info.FullMethod, req, trustServices)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (c *Client) authorize(ctx context.Context, policy AccessPolicy, fullMethod string, req any, trustServices bool) (context.Context, error) {
+	rule, ok := policy.rule(fullMethod)
+	if !ok {
+		log.Printf("no access rule for %s", fullMethod)
+		return nil, status.Error(codes.PermissionDenied, "method not allowed")
+	}
+	if rule.Public {
+		return ctx, nil
+	}
+
+	if len(rule.Services) > 0 {
+		if id, ok := serviceauth.FromContext(ctx); ok && slices.Contains(rule.Services, id.Service) {
+			return ctx, nil
+		}
+		if _, hasToken := BearerTokenFromIncomingContext(ctx); trustServices && !hasToken {
+			return ctx, nil
+		}
+	}
+
+	if !rule.Authenticated && len(rule.Roles) == 0 && len(rule.Permissions) == 0 && rule.Self == nil {
+		return nil, status.Error(codes.PermissionDenied, "method not allowed")
+	}
+
+	claims, err := c.Authenticate(ctx)
+	if status.Code(err) == codes.Unauthenticated {
+		return nil, err
+	} else if err != nil {
+		log.Printf("failed to introspect access token: %v", err)
+		return nil, status.Error(codes.Unavailable, "failed to verify access token")
+	}
+
+	if rule.Authenticated ||
+		slices.ContainsFunc(rule.Roles, claims.HasRole) ||
+		slices.ContainsFunc(rule.Permissions, claims.HasPermission) ||
+		(rule.Self != nil && rule.Self(req) == claims.Subject) {
+		return NewContext(ctx, claims), nil
+	}
+	return nil, status.Error(codes.PermissionDenied, "not allowed to call this method")
+}
@@ -0,0 +1,96 @@
+package authclient
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"authkit/serviceauth"
+)
+
+type getUserRequest struct{ userID string }
+
+func TestAuthorize(t *testing.T) {
+	self := func(req any) string { return req.(*getUserRequest).userID }
+	policy := AccessPolicy{
+		"/pkg.Users/Ping":         {Public: true},
+		"/pkg.Users/Sync":         {Services: []string{"gateway"}},
+		"/pkg.Users/Me":           {Authenticated: true},
+		"/pkg.Users/Purge":        {Roles: []string{"ADMIN"}},
+		"/pkg.Users/Delete":       {Permissions: []string{"user.delete"}},
+		"/pkg.Users/Get":          {Self: self},
+		"/pkg.Users/Internal":     {Services: []string{"gateway"}, Roles: []string{"ADMIN"}},
+		"/pkg.Audit/*":            {Roles: []string{"AUDITOR"}},
+		"/pkg.Audit/Unrestricted": {},
+	}
+
+	background := context.Background()
+	gateway := serviceauth.NewContext(background, serviceauth.Identity{Service: "gateway", Mode: serviceauth.ModeToken})
+	billing := serviceauth.NewContext(background, serviceauth.Identity{Service: "billing", Mode: serviceauth.ModeToken})
+	user := func(claims Claims) context.Context { return NewContext(background, &claims) }
+	// withToken adds a bearer token to ctx, as a gateway forwarding a user
+	// request would.
+	withToken := func(ctx context.Context) context.Context {
+		return metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer token"))
+	}
+
+	alice := Claims{Subject: "alice"}
+	admin := Claims{Subject: "root", Roles: []string{"ADMIN"}}
+	deleter := Claims{Subject: "bob", Permissions: []string{"user.delete"}}
+	auditor := Claims{Subject: "carol", Roles: []string{"AUDITOR"}}
+
+	tests := []struct {
+		name          string
+		ctx           context.Context
+		method        string
+		req           any
+		trustServices bool
+		want          codes.Code
+	}{
+		{"public without a token", background, "/pkg.Users/Ping", nil, false, codes.OK},
+
+		{"listed service", gateway, "/pkg.Users/Sync", nil, false, codes.OK},
+		{"unlisted service", billing, "/pkg.Users/Sync", nil, false, codes.PermissionDenied},
+		{"user on a service-only method", user(admin), "/pkg.Users/Sync", nil, false, codes.PermissionDenied},
+		{"trusted services without a token", background, "/pkg.Users/Sync", nil, true, codes.OK},
+		{"trusted services with a token", withToken(background), "/pkg.Users/Sync", nil, true, codes.PermissionDenied},
+		{"untrusted services without a token", background, "/pkg.Users/Sync", nil, false, codes.PermissionDenied},
+		{"trusted services with a user token falls back to roles", withToken(user(admin)), "/pkg.Users/Internal", nil, true, codes.OK},
+		{"trusted services with a token lacking the role", withToken(user(alice)), "/pkg.Users/Internal", nil, true, codes.PermissionDenied},
+
+		{"authenticated user", user(alice), "/pkg.Users/Me", nil, false, codes.OK},
+		{"authenticated without a token", background, "/pkg.Users/Me", nil, false, codes.Unauthenticated},
+
+		{"holder of the role", user(admin), "/pkg.Users/Purge", nil, false, codes.OK},
+		{"user without the role", user(alice), "/pkg.Users/Purge", nil, false, codes.PermissionDenied},
+		{"role without a token", background, "/pkg.Users/Purge", nil, false, codes.Unauthenticated},
+
+		{"holder of the permission", user(deleter), "/pkg.Users/Delete", nil, false, codes.OK},
+		{"user without the permission", user(alice), "/pkg.Users/Delete", nil, false, codes.PermissionDenied},
+
+		{"the user the request is about", user(alice), "/pkg.Users/Get", &getUserRequest{userID: "alice"}, false, codes.OK},
+		{"another user", user(alice), "/pkg.Users/Get", &getUserRequest{userID: "bob"}, false, codes.PermissionDenied},
+
+		{"service fallback", user(auditor), "/pkg.Audit/List", nil, false, codes.OK},
+		{"service fallback without the role", user(alice), "/pkg.Audit/List", nil, false, codes.PermissionDenied},
+		{"exact rule overrides the fallback", user(auditor), "/pkg.Audit/Unrestricted", nil, false, codes.PermissionDenied},
+
+		{"empty rule", user(admin), "/pkg.Audit/Unrestricted", nil, true, codes.PermissionDenied},
+		{"method missing from the policy", user(admin), "/pkg.Users/Unknown", nil, false, codes.PermissionDenied},
+		{"service missing from the policy", gateway, "/pkg.Other/Get", nil, true, codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, err := (&Client{}).authorize(tt.ctx, policy, tt.method, tt.req, tt.trustServices)
+			if got := status.Code(err); got != tt.want {
+				t.Fatalf("authorize(%s) = %v, want %s", tt.method, err, tt.want)
+			}
+			if err == nil && ctx == nil {
+				t.Error("authorize returned no context")
+			}
+		})
+	}
+}
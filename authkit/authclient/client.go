@@ -0,0 +1,166 @@
+// Package authclient lets Go services validate access tokens against
+// auth-service instead of parsing JWTs themselves.
+package authclient
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "authkit/pb"
+)
+
+var (
+	ErrMissingToken  = status.Error(codes.Unauthenticated, "missing access token")
+	ErrInactiveToken = status.Error(codes.Unauthenticated, "access token is not active")
+)
+
+type Claims struct {
+	Subject   string
+	Username  string
+	Roles     []string
+	SessionID string
+	TokenID   string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	// ActorID is the admin impersonating Subject, if any.
+	ActorID string
+	// ClientID and APIKeyID are set when the token was issued to an OAuth
+	// client or exchanged for an API key rather than signed in for.
+	ClientID    string
+	APIKeyID    string
+	Permissions []string
+}
+
+func (c *Claims) HasRole(role string) bool {
+	return slices.Contains(c.Roles, role)
+}
+
+func (c *Claims) HasPermission(permission string) bool {
+	return slices.Contains(c.Permissions, permission)
+}
+
+// Interactive reports whether the token belongs to the user's own session,
+// as opposed to an OAuth client, an API key or an impersonating admin.
+func (c *Claims) Interactive() bool {
+	return c.ActorID == "" && c.ClientID == "" && c.APIKeyID == ""
+}
+
+type claimsKey struct{}
+
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// FromContext returns the claims of the calling user, if an interceptor
+// already authenticated them.
+func FromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
+
+type Client struct {
+	conn *grpc.ClientConn
+	auth pb.AuthServiceClient
+}
+
+// New dials auth-service at target. The caller owns the client and must Close it.
+func New(target string, opts ...grpc.DialOption) (*Client, error) {
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, auth: pb.NewAuthServiceClient(conn)}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// AuthService exposes the raw gRPC client for RPCs without a helper.
+func (c *Client) AuthService() pb.AuthServiceClient {
+	return c.auth
+}
+
+// Introspect asks auth-service whether token is currently valid and returns
+// its claims. Expired, revoked or malformed tokens yield ErrInactiveToken.
+func (c *Client) Introspect(ctx context.Context, token string) (*Claims, error) {
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+
+	res, err := c.auth.IntrospectToken(ctx, &pb.IntrospectTokenRequest{Token: token})
+	if err != nil {
+		return nil, err
+	}
+
+	if !res.GetActive() {
+		return nil, ErrInactiveToken
+	}
+
+	return &Claims{
+		Subject:   res.GetSubject(),
+		Username:  res.GetUsername(),
+		Roles:     res.GetRoles(),
+		SessionID: res.GetSessionId(),
+		TokenID:   res.GetTokenId(),
+		IssuedAt:  res.GetIssuedAt().AsTime(),
+		ExpiresAt: res.GetExpiresAt().AsTime(),
+		ActorID:   res.GetActorId(),
+		ClientID:  res.GetClientId(),
+		APIKeyID:  res.GetApiKeyId(),
+
+		Permissions: res.GetPermissions(),
+	}, nil
+}
+
+// Authenticate introspects the bearer token of an incoming gRPC request,
+// unless an interceptor already did.
+func (c *Client) Authenticate(ctx context.Context) (*Claims, error) {
+	if claims, ok := FromContext(ctx); ok {
+		return claims, nil
+	}
+
+	token, ok := BearerTokenFromIncomingContext(ctx)
+	if !ok {
+		return nil, ErrMissingToken
+	}
+	return c.Introspect(ctx, token)
+}
+
+// RevokeOtherSessions signs the user out of every session except the one the
+// bearer token on ctx belongs to, and returns how many sessions were ended.
+func (c *Client) RevokeOtherSessions(ctx context.Context, userID string) (int64, error) {
+	req := &pb.RevokeAllSessionsRequest{UserId: userID, KeepCurrentSession: true}
+	res, err := c.auth.RevokeAllSessions(ForwardAuthorization(ctx), req)
+	if err != nil {
+		return 0, err
+	}
+	return res.GetRevokedSessions(), nil
+}
+
+// CheckPasswordGuard fails with ResourceExhausted while the user is locked out
+// by auth-service's login guard.
+func (c *Client) CheckPasswordGuard(ctx context.Context, username string) error {
+	_, err := c.auth.CheckPasswordGuard(ctx, &pb.CheckPasswordGuardRequest{Username: username})
+	return err
+}
+
+// RecordPasswordFailure counts a wrong password towards the user's lockout.
+func (c *Client) RecordPasswordFailure(ctx context.Context, username string) error {
+	_, err := c.auth.RecordPasswordFailure(ctx, &pb.RecordPasswordFailureRequest{Username: username})
+	return err
+}
+
+// RevokeAccessTokens invalidates every access token issued to the user so far.
+// No bearer token is forwarded: the calling service has already authorized
+// the change and is trusted by auth-service to revoke tokens on its own
+// authority, which also lets it do so from background jobs.
+func (c *Client) RevokeAccessTokens(ctx context.Context, userID string) error {
+	_, err := c.auth.RevokeAccessTokens(ctx, &pb.RevokeAccessTokensRequest{UserId: userID})
+	return err
+}
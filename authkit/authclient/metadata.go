@@ -0,0 +1,39 @@
+package authclient
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+const authorizationHeader = "authorization"
+
+func BearerTokenFromIncomingContext(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+
+	values := md.Get(authorizationHeader)
+	if len(values) == 0 {
+		return "", false
+	}
+
+	token, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok || token == "" {
+		return "", false
+	}
+
+	return token, true
+}
+
+// ForwardAuthorization copies the caller's bearer token onto the outgoing
+// context so a downstream call is made on the caller's behalf.
+func ForwardAuthorization(ctx context.Context) context.Context {
+	token, ok := BearerTokenFromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, authorizationHeader, "Bearer "+token)
+}
@@ -0,0 +1,67 @@
+package serviceauth
+
+import (
+	"context"
+	"crypto/tls"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// DialOptions returns the options needed to call the service named audience
+// with this service's identity.
+func DialOptions(cfg *Config, audience string) []grpc.DialOption {
+	switch cfg.Mode {
+	case ModeTLS:
+		tlsConfig := &tls.Config{
+			Certificates: []tls.Certificate{cfg.TLSCertificate},
+			RootCAs:      cfg.TLSRootCAs,
+			MinVersion:   tls.VersionTLS12,
+		}
+		return []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))}
+
+	case ModeToken:
+		return []grpc.DialOption{
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithPerRPCCredentials(&tokenCredentials{cfg: cfg, audience: audience}),
+		}
+
+	default:
+		return []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+}
+
+// tokenCredentials attaches a service token to every call, reusing it until
+// it is close to expiring.
+type tokenCredentials struct {
+	cfg      *Config
+	audience string
+
+	mu    sync.Mutex
+	token string
+	exp   time.Time
+}
+
+func (c *tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Until(c.exp) < c.cfg.TokenTTL/2 {
+		token, exp, err := SignToken(c.cfg.TokenKey, c.cfg.Service, c.audience, c.cfg.TokenTTL)
+		if err != nil {
+			return nil, err
+		}
+		c.token, c.exp = token, exp
+	}
+
+	return map[string]string{tokenHeaderName: c.token}, nil
+}
+
+// Service tokens travel over plaintext inside the cluster network, like the
+// rest of the traffic in token mode.
+func (c *tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
@@ -0,0 +1,141 @@
+package serviceauth
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const tokenHeaderName = "x-service-token"
+
+// AnyService allows every authenticated service to call a method.
+const AnyService = "*"
+
+// Policy lists which services may call each RPC, keyed by full method name
+// ("/user.UserService/GetCredentials") or by service ("/user.RoleService/*").
+// Methods missing from the policy are denied.
+type Policy map[string][]string
+
+func (p Policy) Allows(fullMethod, service string) bool {
+	allowed, ok := p[fullMethod]
+	if !ok {
+		serviceName, _, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+		allowed, ok = p["/"+serviceName+"/*"]
+	}
+	return ok && (slices.Contains(allowed, service) || slices.Contains(allowed, AnyService))
+}
+
+// ServerOptions returns the transport credentials and interceptors a gRPC
+// server needs to authenticate and authorize its callers.
+func ServerOptions(cfg *Config, policy Policy) []grpc.ServerOption {
+	if cfg.Mode == ModeDisabled {
+		log.Println("Service authentication is disabled; accepting calls from any client")
+		return nil
+	}
+
+	a := &authenticator{cfg: cfg, policy: policy}
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(a.unary),
+		grpc.ChainStreamInterceptor(a.stream),
+	}
+
+	if cfg.Mode == ModeTLS {
+		tlsConfig := &tls.Config{
+			Certificates: []tls.Certificate{cfg.TLSCertificate},
+			ClientCAs:    cfg.TLSRootCAs,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			MinVersion:   tls.VersionTLS12,
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	} else {
+		opts = append(opts, grpc.Creds(insecure.NewCredentials()))
+	}
+
+	return opts
+}
+
+type authenticator struct {
+	cfg    *Config
+	policy Policy
+}
+
+func (a *authenticator) unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := a.authorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *authenticator) stream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := a.authorize(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &identityStream{ServerStream: ss, ctx: ctx})
+}
+
+func (a *authenticator) authorize(ctx context.Context, fullMethod string) (context.Context, error) {
+	id, err := a.identify(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !a.policy.Allows(fullMethod, id.Service) {
+		log.Printf("service %s is not allowed to call %s", id.Service, fullMethod)
+		return nil, status.Error(codes.PermissionDenied, "service not allowed to call this method")
+	}
+
+	return NewContext(ctx, id), nil
+}
+
+func (a *authenticator) identify(ctx context.Context) (Identity, error) {
+	switch a.cfg.Mode {
+	case ModeTLS:
+		p, ok := peer.FromContext(ctx)
+		if !ok {
+			break
+		}
+		info, ok := p.AuthInfo.(credentials.TLSInfo)
+		if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+			break
+		}
+		name := info.State.VerifiedChains[0][0].Subject.CommonName
+		if name != "" {
+			return Identity{Service: name, Mode: ModeTLS}, nil
+		}
+
+	case ModeToken:
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get(tokenHeaderName)
+		if len(values) == 0 {
+			break
+		}
+		issuer, err := VerifyToken(values[0], a.cfg.Service, a.cfg.PeerKeys)
+		if err != nil {
+			return Identity{}, status.Error(codes.Unauthenticated, err.Error())
+		}
+		return Identity{Service: issuer, Mode: ModeToken}, nil
+	}
+
+	return Identity{}, status.Error(codes.Unauthenticated, "missing service credentials")
+}
+
+type identityStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *identityStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,147 @@
+// Package serviceauth authenticates calls between Go services. A caller proves
+// its service identity either with an mTLS client certificate or with a short
+// lived token signed by its own key; the server interceptor attaches that
+// identity to the context and checks it against a per-RPC allowlist.
+package serviceauth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type Mode string
+
+const (
+	// ModeTLS requires client certificates issued by the configured CA. The
+	// certificate's common name is the service identity.
+	ModeTLS Mode = "mtls"
+	// ModeToken requires a signed service token on every call. Each service
+	// signs with its own private key and servers verify with the public keys
+	// of the services they accept calls from. Tokens are bearer credentials
+	// sent in plaintext and not bound to a request, so anyone who can read
+	// the traffic can replay one until it expires; use ModeTLS unless the
+	// network between services is trusted.
+	ModeToken Mode = "token"
+	// ModeDisabled accepts any caller. Meant for local development only.
+	ModeDisabled Mode = "disabled"
+)
+
+const defaultTokenTTL = 5 * time.Minute
+
+// Identity is the authenticated service behind a call.
+type Identity struct {
+	Service string
+	Mode    Mode
+}
+
+type identityKey struct{}
+
+func NewContext(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the identity of the calling service, if the call was
+// authenticated.
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+type Config struct {
+	Service string
+	Mode    Mode
+
+	// Used in ModeTLS, both to serve and to dial.
+	TLSCertificate tls.Certificate
+	TLSRootCAs     *x509.CertPool
+
+	// Used in ModeToken. TokenKey signs outgoing calls and PeerKeys verify
+	// incoming ones, keyed by service name.
+	TokenKey ed25519.PrivateKey
+	PeerKeys map[string]ed25519.PublicKey
+	TokenTTL time.Duration
+}
+
+// ConfigFromEnv loads the configuration of the named service:
+//
+//	SERVICE_AUTH_MODE        mtls, token (default) or disabled
+//	SERVICE_TLS_CERT/KEY/CA  PEM files for mtls
+//	SERVICE_TOKEN_KEY        PEM PKCS#8 Ed25519 private key for token
+//	SERVICE_TOKEN_PEERS_DIR  directory of <service>.pub PEM public keys
+func ConfigFromEnv(service string) (*Config, error) {
+	cfg := &Config{
+		Service:  service,
+		Mode:     Mode(getEnv("SERVICE_AUTH_MODE", string(ModeToken))),
+		TokenTTL: defaultTokenTTL,
+	}
+
+	switch cfg.Mode {
+	case ModeTLS:
+		cert, err := tls.LoadX509KeyPair(os.Getenv("SERVICE_TLS_CERT"), os.Getenv("SERVICE_TLS_KEY"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load service certificate: %w", err)
+		}
+		cfg.TLSCertificate = cert
+
+		ca, err := os.ReadFile(os.Getenv("SERVICE_TLS_CA"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read service CA: %w", err)
+		}
+		cfg.TLSRootCAs = x509.NewCertPool()
+		if !cfg.TLSRootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in SERVICE_TLS_CA")
+		}
+
+	case ModeToken:
+		key, err := LoadPrivateKey(os.Getenv("SERVICE_TOKEN_KEY"))
+		if err != nil {
+			return nil, err
+		}
+		cfg.TokenKey = key
+
+		peers, err := LoadPeerKeys(getEnv("SERVICE_TOKEN_PEERS_DIR", "service-keys"))
+		if err != nil {
+			return nil, err
+		}
+		cfg.PeerKeys = peers
+
+	case ModeDisabled:
+
+	default:
+		return nil, fmt.Errorf("SERVICE_AUTH_MODE must be one of mtls, token or disabled")
+	}
+
+	return cfg, nil
+}
+
+// LoadPeerKeys reads every <service>.pub file in dir.
+func LoadPeerKeys(dir string) (map[string]ed25519.PublicKey, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pub"))
+	if err != nil {
+		return nil, err
+	}
+
+	peers := make(map[string]ed25519.PublicKey, len(paths))
+	for _, path := range paths {
+		key, err := LoadPublicKey(path)
+		if err != nil {
+			return nil, err
+		}
+		peers[strings.TrimSuffix(filepath.Base(path), ".pub")] = key
+	}
+	return peers, nil
+}
+
+func getEnv(key, defaultValue string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,152 @@
+package serviceauth
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Service tokens are compact JWTs signed with EdDSA, so other stacks (such as
+// the gateway) can mint them with any JWT library.
+
+const maxClockSkew = 30 * time.Second
+
+var (
+	errMalformedToken = errors.New("malformed service token")
+	errInvalidToken   = errors.New("invalid service token")
+)
+
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"EdDSA","typ":"JWT"}`))
+
+type tokenClaims struct {
+	Issuer    string `json:"iss"`
+	Audience  string `json:"aud"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// SignToken issues a token asserting that issuer is calling audience.
+func SignToken(key ed25519.PrivateKey, issuer, audience string, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	exp := now.Add(ttl)
+
+	payload, err := json.Marshal(tokenClaims{
+		Issuer:    issuer,
+		Audience:  audience,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: exp.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	signingInput := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature := ed25519.Sign(key, []byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), exp, nil
+}
+
+// VerifyToken checks a token addressed to audience and returns its issuer.
+func VerifyToken(token, audience string, peers map[string]ed25519.PublicKey) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errMalformedToken
+	}
+
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", errMalformedToken
+	}
+	var h struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(header, &h); err != nil || h.Alg != "EdDSA" {
+		return "", errMalformedToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errMalformedToken
+	}
+	var claims tokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", errMalformedToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errMalformedToken
+	}
+
+	key, ok := peers[claims.Issuer]
+	if !ok || !ed25519.Verify(key, []byte(parts[0]+"."+parts[1]), signature) {
+		return "", errInvalidToken
+	}
+
+	now := time.Now()
+	switch {
+	case claims.Audience != audience:
+		return "", errInvalidToken
+	case now.After(time.Unix(claims.ExpiresAt, 0).Add(maxClockSkew)):
+		return "", errInvalidToken
+	case now.Add(maxClockSkew).Before(time.Unix(claims.IssuedAt, 0)):
+		return "", errInvalidToken
+	}
+
+	return claims.Issuer, nil
+}
+
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an Ed25519 key", path)
+	}
+	return edKey, nil
+}
+
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an Ed25519 key", path)
+	}
+	return edKey, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+	return block, nil
+}
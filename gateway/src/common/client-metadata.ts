@@ -0,0 +1,45 @@
+import { Metadata, ServerUnaryCall } from '@grpc/grpc-js';
+
+/**
+ * Builds the metadata for a downstream call made on behalf of the client of
+ * an incoming request. The client's access token, if any, is passed on so
+ * the downstream service can authorize the user. auth-service only believes
+ * the forwarded address and user agent when they come from the gateway, and
+ * throttles logins by the forwarded address.
+ */
+export function forwardClientMetadata(
+  incoming?: Metadata,
+  call?: ServerUnaryCall<unknown, unknown>,
+): Metadata {
+  const outgoing = new Metadata();
+
+  const authorization = incoming?.get('authorization')[0];
+  if (typeof authorization === 'string') {
+    outgoing.set('authorization', authorization);
+  }
+
+  const ip = call ? peerAddress(call.getPeer()) : undefined;
+  if (ip) {
+    outgoing.set('x-forwarded-for', ip);
+  }
+
+  const userAgent = incoming?.get('user-agent')[0];
+  if (typeof userAgent === 'string') {
+    outgoing.set('x-forwarded-user-agent', userAgent);
+  }
+
+  return outgoing;
+}
+
+// grpc-js reports peers as "host:port" or "[v6 host]:port", sometimes with
+// an "ipv4:" or "ipv6:" scheme in front.
+function peerAddress(peer: string): string | undefined {
+  const address = peer.replace(/^ipv[46]:/, '');
+  if (address.startsWith('[')) {
+    return address.slice(1, address.indexOf(']'));
+  }
+
+  const portSeparator = address.lastIndexOf(':');
+  const host = portSeparator > 0 ? address.slice(0, portSeparator) : address;
+  return host || undefined;
+}
@@ -0,0 +1,9 @@
+import { Global, Module } from '@nestjs/common';
+import { ServiceTokenSigner } from './service-token';
+
+@Global()
+@Module({
+  providers: [ServiceTokenSigner],
+  exports: [ServiceTokenSigner],
+})
+export class CommonModule {}
@@ -0,0 +1,68 @@
+import { Injectable } from '@nestjs/common';
+import { ConfigService } from '@nestjs/config';
+import { Metadata } from '@grpc/grpc-js';
+import { createPrivateKey, KeyObject, sign } from 'crypto';
+import { readFileSync } from 'fs';
+
+const SERVICE_NAME = 'gateway';
+const TOKEN_HEADER = 'x-service-token';
+const TOKEN_TTL_SECONDS = 5 * 60;
+
+const encodedHeader = Buffer.from(
+  JSON.stringify({ alg: 'EdDSA', typ: 'JWT' }),
+).toString('base64url');
+
+/**
+ * Signs the service tokens that identify the gateway to the Go services when
+ * SERVICE_AUTH_MODE is token, in the format authkit/serviceauth verifies.
+ * Tokens are reused per audience until half their lifetime has passed.
+ */
+@Injectable()
+export class ServiceTokenSigner {
+  private readonly key?: KeyObject;
+  private readonly tokens = new Map<
+    string,
+    { token: string; expiresAt: number }
+  >();
+
+  constructor(configService: ConfigService) {
+    const mode = configService.get<string>('service_auth.mode');
+    if (mode === 'token') {
+      const keyPath = configService.get<string>('service_auth.token_key')!;
+      this.key = createPrivateKey(readFileSync(keyPath));
+    }
+  }
+
+  /** Adds a token for the service named audience to metadata. */
+  attach(metadata: Metadata, audience: string): Metadata {
+    if (this.key) {
+      metadata.set(TOKEN_HEADER, this.token(this.key, audience));
+    }
+    return metadata;
+  }
+
+  private token(key: KeyObject, audience: string): string {
+    const now = Math.floor(Date.now() / 1000);
+    const cached = this.tokens.get(audience);
+    if (cached && cached.expiresAt - now > TOKEN_TTL_SECONDS / 2) {
+      return cached.token;
+    }
+
+    const expiresAt = now + TOKEN_TTL_SECONDS;
+    const payload = Buffer.from(
+      JSON.stringify({
+        iss: SERVICE_NAME,
+        aud: audience,
+        iat: now,
+        exp: expiresAt,
+      }),
+    ).toString('base64url');
+
+    const signingInput = `${encodedHeader}.${payload}`;
+    const signature = sign(null, Buffer.from(signingInput), key);
+    const token = `${signingInput}.${signature.toString('base64url')}`;
+
+    this.tokens.set(audience, { token, expiresAt });
+    return token;
+  }
+}
@@ -8,8 +8,18 @@ export default () => {
       auth: process.env.AUTH_SERVICE_URL,
       last_seen: process.env.LAST_SEEN_URL,
     },
+    // The gateway identifies itself to the services with signed tokens, or
+    // not at all when disabled; it does not support mtls.
+    service_auth: {
+      mode: process.env.SERVICE_AUTH_MODE || 'token',
+      token_key: process.env.SERVICE_TOKEN_KEY || 'service-keys/gateway.key',
+    },
   };
 
+  if (!['token', 'disabled'].includes(config.service_auth.mode)) {
+    throw new Error('SERVICE_AUTH_MODE must be token or disabled');
+  }
+
   // const required = ['USER_SERVICE_URL', 'AUTH_SERVICE_URL', 'LAST_SEEN_URL'];
   const required = [];
   const missing = required.filter((key) => !process.env[key]);
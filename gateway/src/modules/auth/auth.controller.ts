@@ -1,4 +1,5 @@
 import { Controller } from '@nestjs/common';
+import { Metadata, ServerUnaryCall } from '@grpc/grpc-js';
 import {
   GATEWAY_AUTH_SERVICE_NAME,
   GatewayAuthServiceController,
@@ -6,27 +7,62 @@ import {
   LoginResponse,
   RotateRefreshTokenRequest,
   RotateRefreshTokenResponse,
+  VerifySecondFactorRequest,
+  VerifySecondFactorResponse,
 } from 'protos/ts/gateway/gateway';
 import { LoginUseCase } from './usecases/login.usecase';
 import { GrpcMethod } from '@nestjs/microservices';
 import { RotateRefreshTokensUseCase } from './usecases/rotate-refresh-tokens';
+import { VerifySecondFactorUseCase } from './usecases/verify-second-factor.usecase';
+import { forwardClientMetadata } from 'src/common/client-metadata';
 
 @Controller()
 export class AuthController implements GatewayAuthServiceController {
   constructor(
     private readonly loginUseCase: LoginUseCase,
     private readonly rotateRefreshTokensUseCase: RotateRefreshTokensUseCase,
+    private readonly verifySecondFactorUseCase: VerifySecondFactorUseCase,
   ) {}
 
   @GrpcMethod(GATEWAY_AUTH_SERVICE_NAME)
-  login(request: LoginRequest): Promise<LoginResponse> {
-    return this.loginUseCase.execute(request);
+  login(
+    request: LoginRequest,
+    metadata?: Metadata,
+    call?: ServerUnaryCall<LoginRequest, LoginResponse>,
+  ): Promise<LoginResponse> {
+    return this.loginUseCase.execute(
+      request,
+      forwardClientMetadata(metadata, call),
+    );
+  }
+
+  @GrpcMethod(GATEWAY_AUTH_SERVICE_NAME)
+  verifySecondFactor(
+    request: VerifySecondFactorRequest,
+    metadata?: Metadata,
+    call?: ServerUnaryCall<
+      VerifySecondFactorRequest,
+      VerifySecondFactorResponse
+    >,
+  ): Promise<VerifySecondFactorResponse> {
+    return this.verifySecondFactorUseCase.execute(
+      request,
+      forwardClientMetadata(metadata, call),
+    );
   }
 
   @GrpcMethod(GATEWAY_AUTH_SERVICE_NAME)
   rotateRefreshToken(
     request: RotateRefreshTokenRequest,
+    metadata?: Metadata,
+    call?: ServerUnaryCall<
+      RotateRefreshTokenRequest,
+      RotateRefreshTokenResponse
+    >,
   ): Promise<RotateRefreshTokenResponse> {
-    return this.rotateRefreshTokensUseCase.execute(request);
+    return this.rotateRefreshTokensUseCase.execute(
+      request,
+      forwardClientMetadata(metadata, call),
+    );
   }
 }
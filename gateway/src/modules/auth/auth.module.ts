@@ -5,6 +5,7 @@ import { join } from 'path';
 import { AuthController } from './auth.controller';
 import { LoginUseCase } from './usecases/login.usecase';
 import { RotateRefreshTokensUseCase } from './usecases/rotate-refresh-tokens';
+import { VerifySecondFactorUseCase } from './usecases/verify-second-factor.usecase';
 
 @Module({
   imports: [
@@ -28,7 +29,11 @@ import { RotateRefreshTokensUseCase } from './usecases/rotate-refresh-tokens';
       },
     ]),
   ],
-  providers: [LoginUseCase, RotateRefreshTokensUseCase],
+  providers: [
+    LoginUseCase,
+    RotateRefreshTokensUseCase,
+    VerifySecondFactorUseCase,
+  ],
   controllers: [AuthController],
 })
 export class AuthModule {}
@@ -1,22 +1,43 @@
-import { Inject, InternalServerErrorException } from '@nestjs/common';
+import {
+  Inject,
+  Injectable,
+  InternalServerErrorException,
+} from '@nestjs/common';
+import { Metadata } from '@grpc/grpc-js';
 import { ClientGrpc, RpcException } from '@nestjs/microservices';
 import { AuthServiceClient } from 'protos/ts/auth/auth';
 import { LoginRequest, LoginResponse } from 'protos/ts/gateway/gateway';
 import { firstValueFrom } from 'rxjs';
+import { ServiceTokenSigner } from 'src/common/service-token';
 
+@Injectable()
 export class LoginUseCase {
   private authService: AuthServiceClient;
 
-  constructor(@Inject('AUTH_SERVICE') private readonly client: ClientGrpc) {
+  constructor(
+    @Inject('AUTH_SERVICE') private readonly client: ClientGrpc,
+    private readonly serviceTokens: ServiceTokenSigner,
+  ) {
     this.authService = this.client.getService('AuthService');
   }
 
-  async execute(req: LoginRequest): Promise<LoginResponse> {
-    const observableResponse = this.authService.login(req);
+  async execute(
+    req: LoginRequest,
+    metadata: Metadata,
+  ): Promise<LoginResponse> {
+    const observableResponse = this.authService.login(
+      req,
+      this.serviceTokens.attach(metadata, 'auth-service'),
+    );
     const response = await firstValueFrom(observableResponse).catch((error) => {
       throw new RpcException(error as object);
     });
 
+    const secondFactorChallenge = response.secondFactorChallenge;
+    if (secondFactorChallenge) {
+      return { secondFactorChallenge };
+    }
+
     const tokens = response.tokens;
     if (!tokens) {
       throw new RpcException(
@@ -4,25 +4,34 @@ import {
   InternalServerErrorException,
 } from '@nestjs/common';
 import { ClientGrpc, RpcException } from '@nestjs/microservices';
+import { Metadata } from '@grpc/grpc-js';
 import {
   AuthServiceClient,
   RotateRefreshTokenRequest,
   RotateRefreshTokenResponse,
 } from 'protos/ts/auth/auth';
 import { firstValueFrom } from 'rxjs';
+import { ServiceTokenSigner } from 'src/common/service-token';
 
 @Injectable()
 export class RotateRefreshTokensUseCase {
   private authService: AuthServiceClient;
 
-  constructor(@Inject('AUTH_SERVICE') private readonly client: ClientGrpc) {
+  constructor(
+    @Inject('AUTH_SERVICE') private readonly client: ClientGrpc,
+    private readonly serviceTokens: ServiceTokenSigner,
+  ) {
     this.authService = this.client.getService('AuthService');
   }
 
   async execute(
     req: RotateRefreshTokenRequest,
+    metadata: Metadata,
   ): Promise<RotateRefreshTokenResponse> {
-    const observableResponse = this.authService.rotateRefreshToken(req);
+    const observableResponse = this.authService.rotateRefreshToken(
+      req,
+      this.serviceTokens.attach(metadata, 'auth-service'),
+    );
     const response = await firstValueFrom(observableResponse).catch((error) => {
       throw new RpcException(error as object);
     });
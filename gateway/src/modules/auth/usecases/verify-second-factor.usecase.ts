@@ -0,0 +1,48 @@
+import {
+  Inject,
+  Injectable,
+  InternalServerErrorException,
+} from '@nestjs/common';
+import { Metadata } from '@grpc/grpc-js';
+import { ClientGrpc, RpcException } from '@nestjs/microservices';
+import { AuthServiceClient } from 'protos/ts/auth/auth';
+import {
+  VerifySecondFactorRequest,
+  VerifySecondFactorResponse,
+} from 'protos/ts/gateway/gateway';
+import { firstValueFrom } from 'rxjs';
+import { ServiceTokenSigner } from 'src/common/service-token';
+
+@Injectable()
+export class VerifySecondFactorUseCase {
+  private authService: AuthServiceClient;
+
+  constructor(
+    @Inject('AUTH_SERVICE') private readonly client: ClientGrpc,
+    private readonly serviceTokens: ServiceTokenSigner,
+  ) {
+    this.authService = this.client.getService('AuthService');
+  }
+
+  async execute(
+    req: VerifySecondFactorRequest,
+    metadata: Metadata,
+  ): Promise<VerifySecondFactorResponse> {
+    const observableResponse = this.authService.verifySecondFactor(
+      req,
+      this.serviceTokens.attach(metadata, 'auth-service'),
+    );
+    const response = await firstValueFrom(observableResponse).catch((error) => {
+      throw new RpcException(error as object);
+    });
+
+    const tokens = response.tokens;
+    if (!tokens) {
+      throw new RpcException(
+        new InternalServerErrorException('Could not verify second factor'),
+      );
+    }
+
+    return { tokens };
+  }
+}
@@ -6,17 +6,28 @@ import {
   DeleteUserRequest,
   DeleteUserResponse,
 } from 'protos/ts/gateway/gateway';
+import { Metadata } from '@grpc/grpc-js';
+import { ServiceTokenSigner } from 'src/common/service-token';
 
 @Injectable()
 export class DeleteUserUseCase {
   private userService: UserServiceClient;
 
-  constructor(@Inject('USER_SERVICE') private readonly client: ClientGrpc) {
+  constructor(
+    @Inject('USER_SERVICE') private readonly client: ClientGrpc,
+    private readonly serviceTokens: ServiceTokenSigner,
+  ) {
     this.userService = this.client.getService('UserService');
   }
 
-  async execute(req: DeleteUserRequest): Promise<DeleteUserResponse> {
-    const observableResponse = this.userService.deleteUser(req);
+  async execute(
+    req: DeleteUserRequest,
+    metadata: Metadata,
+  ): Promise<DeleteUserResponse> {
+    const observableResponse = this.userService.deleteUser(
+      req,
+      this.serviceTokens.attach(metadata, 'user-service'),
+    );
     await firstValueFrom(observableResponse).catch((error) => {
       throw new RpcException(error as object);
     });
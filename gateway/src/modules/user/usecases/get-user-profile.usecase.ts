@@ -10,26 +10,35 @@ import {
   GetUserProfileRequest,
   GetUserProfileResponse,
 } from 'protos/ts/gateway/gateway';
+import { Metadata } from '@grpc/grpc-js';
+import { ServiceTokenSigner } from 'src/common/service-token';
 import { firstValueFrom, Observable } from 'rxjs';
 
 @Injectable()
 export class GetUserProfileUseCase {
   private userService: UserServiceClient;
 
-  constructor(@Inject('USER_SERVICE') private readonly client: ClientGrpc) {
+  constructor(
+    @Inject('USER_SERVICE') private readonly client: ClientGrpc,
+    private readonly serviceTokens: ServiceTokenSigner,
+  ) {
     this.userService = this.client.getService<UserServiceClient>('UserService');
   }
 
-  async execute({
-    id,
-    username,
-  }: GetUserProfileRequest): Promise<GetUserProfileResponse> {
+  async execute(
+    { id, username }: GetUserProfileRequest,
+    forwarded: Metadata,
+  ): Promise<GetUserProfileResponse> {
     let observableResponse: Observable<GetUserResponse>;
+    const metadata = this.serviceTokens.attach(forwarded, 'user-service');
 
     if (id) {
-      observableResponse = this.userService.getUserById({ id });
+      observableResponse = this.userService.getUserById({ id }, metadata);
     } else if (username) {
-      observableResponse = this.userService.getUserByUsername({ username });
+      observableResponse = this.userService.getUserByUsername(
+        { username },
+        metadata,
+      );
     } else {
       throw new RpcException(
         new BadRequestException('Id or username is required'),
@@ -6,17 +6,25 @@ import {
   RegisterUserRequest,
   RegisterUserResponse,
 } from 'protos/ts/gateway/gateway';
+import { Metadata } from '@grpc/grpc-js';
+import { ServiceTokenSigner } from 'src/common/service-token';
 
 @Injectable()
 export class RegisterUserUseCase {
   private userService: UserServiceClient;
 
-  constructor(@Inject('USER_SERVICE') private readonly client: ClientGrpc) {
+  constructor(
+    @Inject('USER_SERVICE') private readonly client: ClientGrpc,
+    private readonly serviceTokens: ServiceTokenSigner,
+  ) {
     this.userService = this.client.getService<UserServiceClient>('UserService');
   }
 
   async execute(req: RegisterUserRequest): Promise<RegisterUserResponse> {
-    const observableResponse = this.userService.createUser(req);
+    const observableResponse = this.userService.createUser(
+      req,
+      this.serviceTokens.attach(new Metadata(), 'user-service'),
+    );
     return firstValueFrom(observableResponse).catch((error) => {
       throw new RpcException(error as object);
     });
@@ -1,5 +1,6 @@
 import { Controller } from '@nestjs/common';
 import { GrpcMethod } from '@nestjs/microservices';
+import { Metadata, ServerUnaryCall } from '@grpc/grpc-js';
 import {
   DeleteUserRequest,
   DeleteUserResponse,
@@ -13,6 +14,7 @@ import {
 import { RegisterUserUseCase } from './usecases/register-user.usecase';
 import { GetUserProfileUseCase } from './usecases/get-user-profile.usecase';
 import { DeleteUserUseCase } from './usecases/delete-user.usecase';
+import { forwardClientMetadata } from 'src/common/client-metadata';
 
 @Controller()
 export class UserController implements GatewayUserServiceController {
@@ -30,12 +32,24 @@ export class UserController implements GatewayUserServiceController {
   @GrpcMethod(GATEWAY_USER_SERVICE_NAME)
   getUserProfile(
     request: GetUserProfileRequest,
+    metadata?: Metadata,
+    call?: ServerUnaryCall<GetUserProfileRequest, GetUserProfileResponse>,
   ): Promise<GetUserProfileResponse> {
-    return this.getUserProfileUseCase.execute(request);
+    return this.getUserProfileUseCase.execute(
+      request,
+      forwardClientMetadata(metadata, call),
+    );
   }
 
   @GrpcMethod(GATEWAY_USER_SERVICE_NAME)
-  deleteUser(request: DeleteUserRequest): Promise<DeleteUserResponse> {
-    return this.deleteUserUseCase.execute(request);
+  deleteUser(
+    request: DeleteUserRequest,
+    metadata?: Metadata,
+    call?: ServerUnaryCall<DeleteUserRequest, DeleteUserResponse>,
+  ): Promise<DeleteUserResponse> {
+    return this.deleteUserUseCase.execute(
+      request,
+      forwardClientMetadata(metadata, call),
+    );
   }
 }
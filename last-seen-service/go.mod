@@ -3,6 +3,7 @@ module last-seen-service
 go 1.25.0
 
 require (
+	authkit v0.0.0-00010101000000-000000000000
 	go.mongodb.org/mongo-driver v1.17.4 // direct
 	google.golang.org/grpc v1.75.0 // direct
 	google.golang.org/protobuf v1.36.8 // direct
@@ -23,3 +24,5 @@ require (
 	golang.org/x/text v0.26.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20250707201910-8d1bb00bc6a7 // indirect
 )
+
+replace authkit => ../authkit
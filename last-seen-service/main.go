@@ -18,9 +18,16 @@ import (
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"authkit/serviceauth"
+
 	pb "last-seen-service/pb"
 )
 
+// servicePolicy lists which services may call each RPC.
+var servicePolicy = serviceauth.Policy{
+	"/lastseen.LastSeenService/*": {"gateway"},
+}
+
 type UserLastSeen struct {
 	UserID   string    `bson:"_id"`
 	LastSeen time.Time `bson:"last_seen"`
@@ -32,6 +39,11 @@ type server struct {
 }
 
 func main() {
+	serviceAuth, err := serviceauth.ConfigFromEnv("last-seen-service")
+	if err != nil {
+		log.Fatalf("Failed to load service authentication config: %v", err)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -53,7 +65,7 @@ func main() {
 		log.Fatalf("Failed to listen: %v", err)
 	}
 
-	s := grpc.NewServer()
+	s := grpc.NewServer(serviceauth.ServerOptions(serviceAuth, servicePolicy)...)
 
 	lastSeenServer := &server{
 		mongoClient: client,
@@ -0,0 +1,27 @@
+#!/bin/sh
+# Generates the Ed25519 keys services sign their service tokens with when
+# SERVICE_AUTH_MODE is token (the default): one private key per service, and
+# the public keys every service verifies its callers against.
+#
+# Usage: scripts/generate-service-keys.sh [directory]
+#
+# Existing private keys are kept, so running it again only adds what is
+# missing. docker-compose.yml mounts ./service-keys.
+set -eu
+
+dir="${1:-service-keys}"
+umask 077
+mkdir -p "$dir/public"
+
+for service in gateway user-service auth-service last-seen-service; do
+	if [ -f "$dir/$service.key" ]; then
+		echo "keeping $dir/$service.key"
+	else
+		openssl genpkey -algorithm ed25519 -out "$dir/$service.key"
+		echo "generated $dir/$service.key"
+	fi
+	openssl pkey -in "$dir/$service.key" -pubout -out "$dir/public/$service.pub"
+done
+
+chmod 755 "$dir/public"
+chmod 644 "$dir"/public/*.pub
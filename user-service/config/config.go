@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+	"user-service/hasher"
+	"user-service/utils"
+)
+
+type Config struct {
+	PasswordHashing hasher.Config
+	// RoleGrantSweepInterval is how often expired role grants are removed.
+	// Zero disables the sweeper.
+	RoleGrantSweepInterval time.Duration
+}
+
+func LoadConfig() (*Config, error) {
+	bcryptCost, err := intFromEnv("BCRYPT_COST", 10)
+	if err != nil {
+		return nil, err
+	}
+
+	argon2Memory, err := intFromEnv("ARGON2_MEMORY_KIB", 64*1024)
+	if err != nil {
+		return nil, err
+	}
+
+	argon2Iterations, err := intFromEnv("ARGON2_ITERATIONS", 3)
+	if err != nil {
+		return nil, err
+	}
+
+	argon2Parallelism, err := intFromEnv("ARGON2_PARALLELISM", 4)
+	if err != nil {
+		return nil, err
+	}
+	if argon2Parallelism < 1 || argon2Parallelism > 255 {
+		return nil, fmt.Errorf("ARGON2_PARALLELISM must be between 1 and 255")
+	}
+
+	// Peak hashing memory is roughly this times ARGON2_MEMORY_KIB.
+	passwordHashMaxConcurrency, err := intFromEnv("PASSWORD_HASH_MAX_CONCURRENCY", 4)
+	if err != nil {
+		return nil, err
+	}
+	if passwordHashMaxConcurrency < 1 {
+		return nil, fmt.Errorf("PASSWORD_HASH_MAX_CONCURRENCY must be positive")
+	}
+
+	roleGrantSweepInterval, err := durationFromEnv("ROLE_GRANT_SWEEP_INTERVAL", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Config{
+		PasswordHashing: hasher.Config{
+			Algorithm:  utils.GetEnv("PASSWORD_HASH_ALGORITHM", hasher.AlgorithmArgon2id),
+			BcryptCost: bcryptCost,
+			Argon2id: hasher.Argon2idParams{
+				Memory:      uint32(argon2Memory),
+				Iterations:  uint32(argon2Iterations),
+				Parallelism: uint8(argon2Parallelism),
+				SaltLength:  16,
+				KeyLength:   32,
+			},
+			MaxConcurrent: passwordHashMaxConcurrency,
+		},
+		RoleGrantSweepInterval: roleGrantSweepInterval,
+	}, nil
+}
+
+func intFromEnv(key string, defaultValue int) (int, error) {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultValue, nil
+	}
+
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer: %w", key, err)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("%s must not be negative", key)
+	}
+	return n, nil
+}
+
+func durationFromEnv(key string, defaultValue time.Duration) (time.Duration, error) {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultValue, nil
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a duration: %w", key, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%s must not be negative", key)
+	}
+	return d, nil
+}
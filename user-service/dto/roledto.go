@@ -1,5 +1,18 @@
 package dto
 
+import "time"
+
 type CreateRoleDto struct {
-	Name string
+	Name        string
+	Permissions []string
+	// ParentIds are the roles the new role inherits.
+	ParentIds []string
+}
+
+type AssignRoleDto struct {
+	UserID    string
+	RoleID    string
+	GrantedBy string
+	// ExpiresAt is nil for a permanent grant.
+	ExpiresAt *time.Time
 }
@@ -5,6 +5,7 @@ import "user-service/models"
 type CreateUserDto struct {
 	Name     string
 	Username string
+	Email    *string
 	Password string
 }
 
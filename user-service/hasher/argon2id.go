@@ -0,0 +1,114 @@
+package hasher
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+type Argon2idParams struct {
+	// Memory is in KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+func (p Argon2idParams) validate() error {
+	switch {
+	case p.Memory < 8*uint32(p.Parallelism):
+		return errors.New("hasher: argon2id memory must be at least 8 KiB per lane")
+	case p.Iterations < 1:
+		return errors.New("hasher: argon2id iterations must be positive")
+	case p.Parallelism < 1:
+		return errors.New("hasher: argon2id parallelism must be positive")
+	case p.SaltLength < 8:
+		return errors.New("hasher: argon2id salt must be at least 8 bytes")
+	case p.KeyLength < 16:
+		return errors.New("hasher: argon2id key must be at least 16 bytes")
+	}
+	return nil
+}
+
+// weakerThan compares parameters recovered from an encoded hash against the
+// configured ones. The salt length cannot be recovered and parallelism does
+// not change the cost to an attacker, so neither is considered; hashes made
+// with stronger settings are left alone after a downgrade.
+func (p Argon2idParams) weakerThan(configured Argon2idParams) bool {
+	return p.Memory < configured.Memory ||
+		p.Iterations < configured.Iterations ||
+		p.KeyLength < configured.KeyLength
+}
+
+func hashArgon2id(password string, p Argon2idParams) (string, error) {
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func verifyArgon2id(encoded, password string) error {
+	p, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return err
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	if subtle.ConstantTimeCompare(key, candidate) != 1 {
+		return ErrMismatchedPassword
+	}
+	return nil
+}
+
+func argon2idParamsOf(encoded string) (Argon2idParams, error) {
+	p, _, _, err := decodeArgon2id(encoded)
+	return p, err
+}
+
+// decodeArgon2id parses "$argon2id$v=19$m=<KiB>,t=<iterations>,p=<lanes>$<salt>$<key>".
+func decodeArgon2id(encoded string) (Argon2idParams, []byte, []byte, error) {
+	var p Argon2idParams
+
+	fields := strings.Split(encoded, "$")
+	if len(fields) != 6 || fields[1] != "argon2id" {
+		return p, nil, nil, ErrMalformedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(fields[2], "v=%d", &version); err != nil {
+		return p, nil, nil, ErrMalformedHash
+	}
+	if version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("%w: unsupported argon2 version %d", ErrMalformedHash, version)
+	}
+
+	if _, err := fmt.Sscanf(fields[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, ErrMalformedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(fields[4])
+	if err != nil {
+		return p, nil, nil, ErrMalformedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(fields[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, ErrMalformedHash
+	}
+
+	p.KeyLength = uint32(len(key))
+	return p, salt, key, nil
+}
@@ -0,0 +1,142 @@
+// Package hasher encodes passwords as self-describing PHC strings, so stored
+// hashes carry their own algorithm and parameters and can be upgraded over
+// time without invalidating existing passwords.
+package hasher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+var (
+	ErrMismatchedPassword = errors.New("hasher: password does not match hash")
+	ErrUnknownAlgorithm   = errors.New("hasher: unknown hash algorithm")
+	ErrMalformedHash      = errors.New("hasher: malformed hash")
+)
+
+type Config struct {
+	// Algorithm is used for new hashes. Hashes made with any supported
+	// algorithm can still be verified.
+	Algorithm  string
+	BcryptCost int
+	Argon2id   Argon2idParams
+	// MaxConcurrent bounds how many hashes are computed at once. Each
+	// argon2id computation holds Argon2id.Memory, so this caps the memory a
+	// burst of logins can claim; callers beyond it wait their turn or until
+	// their context is done.
+	MaxConcurrent int
+}
+
+type Hasher interface {
+	Hash(ctx context.Context, password string) (string, error)
+	// Verify returns ErrMismatchedPassword when password does not match.
+	Verify(ctx context.Context, encoded, password string) error
+	// NeedsRehash reports whether encoded was made with a different algorithm
+	// or weaker parameters than the ones currently configured.
+	NeedsRehash(encoded string) bool
+}
+
+type phcHasher struct {
+	config Config
+	slots  chan struct{}
+}
+
+func New(config Config) (Hasher, error) {
+	switch config.Algorithm {
+	case AlgorithmArgon2id:
+		if err := config.Argon2id.validate(); err != nil {
+			return nil, err
+		}
+	case AlgorithmBcrypt:
+		if err := validateBcryptCost(config.BcryptCost); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAlgorithm, config.Algorithm)
+	}
+	if config.MaxConcurrent < 1 {
+		return nil, errors.New("hasher: max concurrent hashes must be positive")
+	}
+	return &phcHasher{config: config, slots: make(chan struct{}, config.MaxConcurrent)}, nil
+}
+
+func (h *phcHasher) Hash(ctx context.Context, password string) (string, error) {
+	if err := h.acquire(ctx); err != nil {
+		return "", err
+	}
+	defer h.release()
+
+	if h.config.Algorithm == AlgorithmBcrypt {
+		return hashBcrypt(password, h.config.BcryptCost)
+	}
+	return hashArgon2id(password, h.config.Argon2id)
+}
+
+func (h *phcHasher) Verify(ctx context.Context, encoded, password string) error {
+	if err := h.acquire(ctx); err != nil {
+		return err
+	}
+	defer h.release()
+
+	switch algorithmOf(encoded) {
+	case AlgorithmArgon2id:
+		return verifyArgon2id(encoded, password)
+	case AlgorithmBcrypt:
+		return verifyBcrypt(encoded, password)
+	default:
+		return ErrUnknownAlgorithm
+	}
+}
+
+func (h *phcHasher) NeedsRehash(encoded string) bool {
+	if algorithmOf(encoded) != h.config.Algorithm {
+		return true
+	}
+
+	if h.config.Algorithm == AlgorithmBcrypt {
+		cost, err := bcryptCost(encoded)
+		return err != nil || cost < h.config.BcryptCost
+	}
+
+	params, err := argon2idParamsOf(encoded)
+	return err != nil || params.weakerThan(h.config.Argon2id)
+}
+
+// acquire waits for a free hashing slot, giving up once ctx is done.
+func (h *phcHasher) acquire(ctx context.Context) error {
+	select {
+	case h.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (h *phcHasher) release() {
+	<-h.slots
+}
+
+// algorithmOf reads the identifier between the first two dollar signs. bcrypt
+// predates PHC and is recognized by its "2a", "2b" and "2y" variants.
+func algorithmOf(encoded string) string {
+	fields := strings.SplitN(encoded, "$", 3)
+	if len(fields) < 3 || fields[0] != "" {
+		return ""
+	}
+
+	switch fields[1] {
+	case "argon2id":
+		return AlgorithmArgon2id
+	case "2a", "2b", "2y":
+		return AlgorithmBcrypt
+	default:
+		return ""
+	}
+}
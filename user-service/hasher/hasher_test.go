@@ -0,0 +1,149 @@
+package hasher
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// testArgon2id is cheap enough for tests; production settings come from
+// config.
+var testArgon2id = Argon2idParams{Memory: 64, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func newTestHasher(t *testing.T, algorithm string) *phcHasher {
+	t.Helper()
+
+	h, err := New(Config{Algorithm: algorithm, BcryptCost: 5, Argon2id: testArgon2id, MaxConcurrent: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h.(*phcHasher)
+}
+
+// mustHash unwraps the result of a hash function, as in
+// mustHash(t)(h.Hash(ctx, password)).
+func mustHash(t *testing.T) func(string, error) string {
+	return func(encoded string, err error) string {
+		t.Helper()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encoded
+	}
+}
+
+func TestHashVerifyRoundTrip(t *testing.T) {
+	ctx := context.Background()
+
+	for _, algorithm := range []string{AlgorithmArgon2id, AlgorithmBcrypt} {
+		t.Run(algorithm, func(t *testing.T) {
+			h := newTestHasher(t, algorithm)
+
+			encoded := mustHash(t)(h.Hash(ctx, "correct horse"))
+			if got := algorithmOf(encoded); got != algorithm {
+				t.Errorf("hash %q has algorithm %q, want %q", encoded, got, algorithm)
+			}
+			if err := h.Verify(ctx, encoded, "correct horse"); err != nil {
+				t.Errorf("Verify with the right password: %v", err)
+			}
+			if err := h.Verify(ctx, encoded, "battery staple"); !errors.Is(err, ErrMismatchedPassword) {
+				t.Errorf("Verify with a wrong password = %v, want ErrMismatchedPassword", err)
+			}
+		})
+	}
+}
+
+func TestVerifyAcceptsEitherAlgorithm(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHasher(t, AlgorithmArgon2id)
+
+	legacy := mustHash(t)(hashBcrypt("correct horse", 4))
+	if err := h.Verify(ctx, legacy, "correct horse"); err != nil {
+		t.Errorf("argon2id hasher rejected a bcrypt hash: %v", err)
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	argon2id := newTestHasher(t, AlgorithmArgon2id)
+	bcrypt := newTestHasher(t, AlgorithmBcrypt)
+
+	with := func(change func(*Argon2idParams)) string {
+		p := testArgon2id
+		change(&p)
+		return mustHash(t)(hashArgon2id("password", p))
+	}
+
+	tests := []struct {
+		name    string
+		hasher  *phcHasher
+		encoded string
+		want    bool
+	}{
+		{"argon2id with current params", argon2id, with(func(*Argon2idParams) {}), false},
+		{"argon2id with less memory", argon2id, with(func(p *Argon2idParams) { p.Memory = 32 }), true},
+		{"argon2id with fewer iterations", argon2id, with(func(p *Argon2idParams) { p.Iterations = 1 }), true},
+		{"argon2id with a shorter key", argon2id, with(func(p *Argon2idParams) { p.KeyLength = 16 }), true},
+		{"argon2id with more memory", argon2id, with(func(p *Argon2idParams) { p.Memory = 128 }), false},
+		{"argon2id with more iterations", argon2id, with(func(p *Argon2idParams) { p.Iterations = 3 }), false},
+		{"argon2id with a different parallelism", argon2id, with(func(p *Argon2idParams) { p.Parallelism = 2 }), false},
+		{"bcrypt under argon2id", argon2id, mustHash(t)(hashBcrypt("password", 5)), true},
+		{"malformed argon2id", argon2id, "$argon2id$v=19$m=64", true},
+		{"bcrypt with current cost", bcrypt, mustHash(t)(hashBcrypt("password", 5)), false},
+		{"bcrypt with a lower cost", bcrypt, mustHash(t)(hashBcrypt("password", 4)), true},
+		{"bcrypt with a higher cost", bcrypt, mustHash(t)(hashBcrypt("password", 6)), false},
+		{"argon2id under bcrypt", bcrypt, with(func(*Argon2idParams) {}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hasher.NeedsRehash(tt.encoded); got != tt.want {
+				t.Errorf("NeedsRehash(%q) = %v, want %v", tt.encoded, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsMalformedHashes(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHasher(t, AlgorithmArgon2id)
+
+	tests := []struct {
+		name    string
+		encoded string
+		want    error
+	}{
+		{"empty", "", ErrUnknownAlgorithm},
+		{"unknown algorithm", "$scrypt$ln=15,r=8,p=1$c2FsdA$a2V5", ErrUnknownAlgorithm},
+		{"missing fields", "$argon2id$v=19$m=64,t=2,p=1$c2FsdHNhbHQ", ErrMalformedHash},
+		{"unsupported version", "$argon2id$v=16$m=64,t=2,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5", ErrMalformedHash},
+		{"malformed params", "$argon2id$v=19$m=64$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5", ErrMalformedHash},
+		{"invalid salt encoding", "$argon2id$v=19$m=64,t=2,p=1$!!!$a2V5a2V5a2V5a2V5", ErrMalformedHash},
+		{"empty key", "$argon2id$v=19$m=64,t=2,p=1$c2FsdHNhbHQ$", ErrMalformedHash},
+		{"truncated bcrypt", "$2b$05$tooshort", ErrMalformedHash},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := h.Verify(ctx, tt.encoded, "password"); !errors.Is(err, tt.want) {
+				t.Errorf("Verify(%q) = %v, want %v", tt.encoded, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashGivesUpWhenContextIsDone(t *testing.T) {
+	h := newTestHasher(t, AlgorithmArgon2id)
+
+	// Occupy the only slot, as a concurrent hash would.
+	h.slots <- struct{}{}
+	defer h.release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := h.Hash(ctx, "password"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Hash = %v, want context.Canceled", err)
+	}
+	if err := h.Verify(ctx, "$2b$04$abc", "password"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Verify = %v, want context.Canceled", err)
+	}
+}
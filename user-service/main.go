@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
@@ -10,6 +11,10 @@ import (
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 
+	"authkit/authclient"
+	"authkit/serviceauth"
+	"user-service/config"
+	"user-service/hasher"
 	"user-service/models"
 	pb "user-service/pb"
 	"user-service/repository"
@@ -19,23 +24,47 @@ import (
 )
 
 func main() {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	serviceAuth, err := serviceauth.ConfigFromEnv("user-service")
+	if err != nil {
+		log.Fatalf("Failed to load service authentication config: %v", err)
+	}
+
+	passwordHasher, err := hasher.New(cfg.PasswordHashing)
+	if err != nil {
+		log.Fatalf("Failed to initialize password hasher: %v", err)
+	}
+
 	db, err := initializeDatabase()
 	if err != nil {
 		log.Fatalf("Database initialization failed: %v", err)
 	}
 
+	authClient, err := connectToAuthService(serviceAuth)
+	if err != nil {
+		log.Fatalf("Failed to connect to Auth Service: %v", err)
+	}
+	defer authClient.Close()
+
 	roleRepository := repository.NewGormRoleRepository(db)
-	roleService := service.NewRoleService(roleRepository)
+	roleService := service.NewRoleService(roleRepository, authClient)
 
 	userRepository := repository.NewGormUserRepository(db)
-	userService := service.NewUserService(userRepository, roleService)
+	userService := service.NewUserService(userRepository, roleService, passwordHasher, authClient)
 
-	if err := SeedAdmin(db); err != nil {
+	if err := SeedAdmin(db, passwordHasher); err != nil {
 		log.Fatalf("Failed to seed admin user: %v", err)
 	}
 
+	roleGrantSweeper := service.NewRoleGrantSweeper(userRepository, authClient, cfg)
+	go roleGrantSweeper.Run(context.Background())
+
 	serverPort := utils.GetEnv("GRPC_PORT", "50051")
-	lis, s, err := setupGRPCServer(serverPort, userService, roleService)
+	lis, s, err := setupGRPCServer(serverPort, serviceAuth, authClient, userService, roleService)
 	if err != nil {
 		log.Fatalf("gRPC server setup failed: %v", err)
 	}
@@ -55,7 +84,13 @@ func initializeDatabase() (*gorm.DB, error) {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	err = db.AutoMigrate(&models.User{}, &models.Role{}, &models.UserRole{})
+	// Grants carry who made them and when, so the Roles association has to
+	// go through the UserRole model.
+	if err := db.SetupJoinTable(&models.User{}, "Roles", &models.UserRole{}); err != nil {
+		return nil, fmt.Errorf("failed to set up user roles join table: %w", err)
+	}
+
+	err = db.AutoMigrate(&models.User{}, &models.Role{}, &models.UserRole{}, &models.RolePermission{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to run database migrations: %w", err)
 	}
@@ -63,7 +98,16 @@ func initializeDatabase() (*gorm.DB, error) {
 	return db, nil
 }
 
-func setupGRPCServer(port string, userService service.UserService, roleService service.RoleService) (net.Listener, *grpc.Server, error) {
+func connectToAuthService(serviceAuth *serviceauth.Config) (*authclient.Client, error) {
+	authServiceAddr := utils.GetEnv("AUTH_SERVICE_URL", "auth-service:50051")
+	client, err := authclient.New(authServiceAddr, serviceauth.DialOptions(serviceAuth, "auth-service")...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Auth Service: %w", err)
+	}
+	return client, nil
+}
+
+func setupGRPCServer(port string, serviceAuth *serviceauth.Config, authClient *authclient.Client, userService service.UserService, roleService service.RoleService) (net.Listener, *grpc.Server, error) {
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to listen on port %s: %w", port, err)
@@ -72,7 +116,14 @@ func setupGRPCServer(port string, userService service.UserService, roleService s
 	userServer := server.NewUserServer(userService, roleService)
 	roleServer := server.NewRoleServer(roleService)
 
-	s := grpc.NewServer()
+	// Callers are authorized as services first, then as users.
+	trustServices := serviceAuth.Mode == serviceauth.ModeDisabled
+	opts := append(
+		serviceauth.ServerOptions(serviceAuth, server.Policy),
+		grpc.ChainUnaryInterceptor(authClient.UnaryServerInterceptor(server.AccessPolicy, trustServices)),
+	)
+
+	s := grpc.NewServer(opts...)
 	pb.RegisterUserServiceServer(s, userServer)
 	pb.RegisterRoleServiceServer(s, roleServer)
 
@@ -1,28 +1,55 @@
 package models
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type User struct {
-	ID       string `gorm:"primaryKey"`
-	Name     string `gorm:"not null"`
-	Username string `gorm:"not null;uniqueIndex"`
+	ID       string  `gorm:"primaryKey"`
+	Name     string  `gorm:"not null"`
+	Username string  `gorm:"not null;uniqueIndex"`
+	Email    *string `gorm:"uniqueIndex;type:varchar(320)"`
+	// Password is empty for accounts provisioned through an external
+	// identity provider until the user sets one.
 	Password string `gorm:"not null"`
 	Roles    []Role `gorm:"many2many:user_roles;"`
 }
 
 type Role struct {
-	ID   string `gorm:"primaryKey"`
-	Name string `gorm:"uniqueIndex;not null"`
+	ID          string           `gorm:"primaryKey"`
+	Name        string           `gorm:"uniqueIndex;not null"`
+	Permissions []RolePermission `gorm:"constraint:OnDelete:CASCADE"`
+	// Parents are the roles this role inherits: holders of MODERATOR with
+	// parent MEMBER are members as well.
+	Parents []Role `gorm:"many2many:role_parents;joinForeignKey:RoleID;joinReferences:ParentID;constraint:OnDelete:CASCADE"`
+}
+
+// RoleParent is a row of the role_parents join table behind Role.Parents.
+type RoleParent struct {
+	RoleID   string `gorm:"primaryKey"`
+	ParentID string `gorm:"primaryKey"`
 }
 
+// RolePermission grants a permission, such as "user.delete", to every holder
+// of the role.
+type RolePermission struct {
+	RoleID     string `gorm:"primaryKey"`
+	Permission string `gorm:"primaryKey;type:varchar(128)"`
+}
+
+// UserRole grants Role to User, until ExpiresAt when it is set. Expired
+// grants are ignored when loading users and deleted by the sweeper.
 type UserRole struct {
-	UserID string `gorm:"primaryKey"`
-	RoleID string `gorm:"primaryKey"`
-	User   User
-	Role   Role
+	UserID    string `gorm:"primaryKey"`
+	RoleID    string `gorm:"primaryKey"`
+	GrantedBy string
+	GrantedAt time.Time  `gorm:"autoCreateTime"`
+	ExpiresAt *time.Time `gorm:"index"`
+	User      User
+	Role      Role
 }
 
 func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
@@ -35,6 +62,24 @@ func (r *Role) BeforeCreate(tx *gorm.DB) (err error) {
 	return nil
 }
 
+// PermissionNames returns the names of the permissions granted by the role.
+func (r *Role) PermissionNames() []string {
+	names := make([]string, 0, len(r.Permissions))
+	for _, p := range r.Permissions {
+		names = append(names, p.Permission)
+	}
+	return names
+}
+
+// ParentNames returns the names of the roles the role directly inherits.
+func (r *Role) ParentNames() []string {
+	names := make([]string, 0, len(r.Parents))
+	for _, p := range r.Parents {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
 func setIDIfEmpty(id *string) {
 	if *id == "" {
 		*id = uuid.NewString()
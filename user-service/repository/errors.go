@@ -4,3 +4,5 @@ import "errors"
 
 var ErrDuplicateKey = errors.New("repository: duplicate key constraint violation")
 var ErrEntityNotFound = errors.New("repository: entity was not found")
+var ErrRoleCycle = errors.New("repository: role hierarchy would contain a cycle")
+var ErrRoleInUse = errors.New("repository: role is still granted to users or inherited by other roles")
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"slices"
+	"time"
+	"user-service/models"
+
+	"gorm.io/gorm"
+)
+
+// activeGrants limits a query joining user_roles to grants that have not
+// expired.
+func activeGrants(tx *gorm.DB) *gorm.DB {
+	return tx.Where("(user_roles.expires_at IS NULL OR user_roles.expires_at > ?)", time.Now())
+}
+
+// grantedRoles returns the roles granted to the user that have not expired.
+func grantedRoles(tx *gorm.DB, userId string) ([]models.Role, error) {
+	var roles []models.Role
+	err := tx.Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userId).
+		Scopes(activeGrants).
+		Find(&roles).Error
+	return roles, err
+}
+
+// roleEdges returns the roles one step away from roleIds in the hierarchy,
+// either their parents or their children.
+type roleEdges func(roleIds []string) ([]string, error)
+
+// parentsOf looks up the roles that roleIds directly inherit.
+func parentsOf(tx *gorm.DB) roleEdges {
+	return pluckRoleParents(tx, "role_id", "parent_id")
+}
+
+// childrenOf looks up the roles that directly inherit roleIds.
+func childrenOf(tx *gorm.DB) roleEdges {
+	return pluckRoleParents(tx, "parent_id", "role_id")
+}
+
+func pluckRoleParents(tx *gorm.DB, from, to string) roleEdges {
+	return func(roleIds []string) ([]string, error) {
+		var ids []string
+		err := tx.Model(&models.RoleParent{}).Where(from+" IN ?", roleIds).Pluck(to, &ids).Error
+		return ids, err
+	}
+}
+
+// inheritedRoleIds walks the role hierarchy upwards from roleIds and returns
+// every role reached, the starting ones included.
+func inheritedRoleIds(tx *gorm.DB, roleIds []string) ([]string, error) {
+	return walkRoleHierarchy(roleIds, parentsOf(tx))
+}
+
+// inheritingRoleIds walks the role hierarchy downwards from roleIds and
+// returns every role that inherits from them, the starting ones included.
+func inheritingRoleIds(tx *gorm.DB, roleIds []string) ([]string, error) {
+	return walkRoleHierarchy(roleIds, childrenOf(tx))
+}
+
+// createsRoleCycle reports whether giving roleId the parents parentIds would
+// make it inherit itself, directly or through other roles.
+func createsRoleCycle(roleId string, parentIds []string, parents roleEdges) (bool, error) {
+	inherited, err := walkRoleHierarchy(parentIds, parents)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(inherited, roleId), nil
+}
+
+// walkRoleHierarchy follows next from roleIds until no new role is reached.
+// Each role is visited once, so a cycle already present in the table cannot
+// make it loop.
+func walkRoleHierarchy(roleIds []string, next roleEdges) ([]string, error) {
+	seen := make(map[string]bool)
+	var ids []string
+
+	frontier := roleIds
+	for len(frontier) > 0 {
+		var fresh []string
+		for _, id := range frontier {
+			if !seen[id] {
+				seen[id] = true
+				fresh = append(fresh, id)
+			}
+		}
+		if len(fresh) == 0 {
+			break
+		}
+		ids = append(ids, fresh...)
+
+		var err error
+		if frontier, err = next(fresh); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// effectiveRoles expands roles with everything they inherit, each loaded with
+// its permissions.
+func effectiveRoles(tx *gorm.DB, roles []models.Role) ([]models.Role, error) {
+	if len(roles) == 0 {
+		return roles, nil
+	}
+
+	roleIds := make([]string, len(roles))
+	for i := range roles {
+		roleIds[i] = roles[i].ID
+	}
+	roleIds, err := inheritedRoleIds(tx, roleIds)
+	if err != nil {
+		return nil, err
+	}
+
+	var expanded []models.Role
+	if err := tx.Preload("Permissions").Where("id IN ?", roleIds).Order("name").Find(&expanded).Error; err != nil {
+		return nil, err
+	}
+	return expanded, nil
+}
+
+func createRoleParents(tx *gorm.DB, roleId string, parentIds []string) error {
+	if len(parentIds) == 0 {
+		return nil
+	}
+	parents := make([]models.RoleParent, len(parentIds))
+	for i, parentId := range parentIds {
+		parents[i] = models.RoleParent{RoleID: roleId, ParentID: parentId}
+	}
+	return tx.Create(&parents).Error
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"slices"
+	"testing"
+)
+
+// hierarchy maps a role id to the ids of the roles it directly inherits.
+type hierarchy map[string][]string
+
+func (h hierarchy) parents(roleIds []string) ([]string, error) {
+	var ids []string
+	for _, id := range roleIds {
+		ids = append(ids, h[id]...)
+	}
+	return ids, nil
+}
+
+func (h hierarchy) children(roleIds []string) ([]string, error) {
+	var ids []string
+	for child, parents := range h {
+		for _, parent := range parents {
+			if slices.Contains(roleIds, parent) {
+				ids = append(ids, child)
+			}
+		}
+	}
+	return ids, nil
+}
+
+func TestCreatesRoleCycle(t *testing.T) {
+	// MEMBER <- MODERATOR <- SUPERVISOR, and GUEST on its own.
+	h := hierarchy{
+		"MODERATOR":  {"MEMBER"},
+		"SUPERVISOR": {"MODERATOR"},
+	}
+
+	tests := []struct {
+		name    string
+		roleId  string
+		parents []string
+		want    bool
+	}{
+		{"self", "MEMBER", []string{"MEMBER"}, true},
+		{"direct", "MEMBER", []string{"MODERATOR"}, true},
+		{"indirect", "MEMBER", []string{"SUPERVISOR"}, true},
+		{"among several parents", "MEMBER", []string{"GUEST", "SUPERVISOR"}, true},
+		{"new ancestor", "MEMBER", []string{"GUEST"}, false},
+		{"existing ancestor", "SUPERVISOR", []string{"MEMBER"}, false},
+		{"no parents", "MEMBER", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := createsRoleCycle(tt.roleId, tt.parents, h.parents)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("createsRoleCycle(%s, %v) = %v, want %v", tt.roleId, tt.parents, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWalkRoleHierarchy(t *testing.T) {
+	// A diamond: ADMIN inherits MODERATOR and EDITOR, which both inherit
+	// MEMBER.
+	h := hierarchy{
+		"ADMIN":     {"MODERATOR", "EDITOR"},
+		"MODERATOR": {"MEMBER"},
+		"EDITOR":    {"MEMBER"},
+	}
+	// LOOP_A and LOOP_B inherit each other, as rows written before cycle
+	// detection could.
+	cyclic := hierarchy{
+		"LOOP_A": {"LOOP_B"},
+		"LOOP_B": {"LOOP_A"},
+	}
+
+	tests := []struct {
+		name  string
+		start []string
+		next  roleEdges
+		want  []string
+	}{
+		{"leaf", []string{"MEMBER"}, h.parents, []string{"MEMBER"}},
+		{"one level", []string{"MODERATOR"}, h.parents, []string{"MEMBER", "MODERATOR"}},
+		{"diamond", []string{"ADMIN"}, h.parents, []string{"ADMIN", "EDITOR", "MEMBER", "MODERATOR"}},
+		{"overlapping starts", []string{"MODERATOR", "EDITOR"}, h.parents, []string{"EDITOR", "MEMBER", "MODERATOR"}},
+		{"inheriting roles", []string{"MEMBER"}, h.children, []string{"ADMIN", "EDITOR", "MEMBER", "MODERATOR"}},
+		{"existing cycle", []string{"LOOP_A"}, cyclic.parents, []string{"LOOP_A", "LOOP_B"}},
+		{"nothing", nil, h.parents, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := walkRoleHierarchy(tt.start, tt.next)
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("walkRoleHierarchy(%v) = %v, want %v", tt.start, got, tt.want)
+			}
+		})
+	}
+}
@@ -13,9 +13,31 @@ import (
 type RoleRepository interface {
 	CreateRole(ctx context.Context, data *dto.CreateRoleDto) (*models.Role, error)
 	CreateRoles(ctx context.Context, data []dto.CreateRoleDto) ([]models.Role, error)
+	GetRoleById(ctx context.Context, id string) (*models.Role, error)
 	GetRoleByName(ctx context.Context, name string) (*models.Role, error)
 	GetRolesByNames(ctx context.Context, name []string) ([]models.Role, error)
-	DeleteRoleById(ctx context.Context, id string) error
+	// SetRolePermissions replaces the permissions granted by the role.
+	SetRolePermissions(ctx context.Context, roleId string, permissions []string) (*models.Role, error)
+	// SetRoleParents replaces the roles the role inherits. It fails with
+	// ErrRoleCycle if the role would end up inheriting itself.
+	SetRoleParents(ctx context.Context, roleId string, parentIds []string) (*models.Role, error)
+	// GetEffectiveRoles returns the role and every role it inherits, each
+	// loaded with its permissions.
+	GetEffectiveRoles(ctx context.Context, roleId string) ([]models.Role, error)
+	// UserHasPermission reports whether any role of the user, directly held
+	// or inherited, grants permission.
+	UserHasPermission(ctx context.Context, userId string, permission string) (bool, error)
+	// ListRoles returns up to limit roles named after the given name, ordered
+	// by name.
+	ListRoles(ctx context.Context, after string, limit int) ([]models.Role, error)
+	RenameRole(ctx context.Context, id string, name string) (*models.Role, error)
+	// ListRoleGrants returns up to limit unexpired grants of the role to users
+	// with ids after the given one, ordered by user id.
+	ListRoleGrants(ctx context.Context, roleId string, after string, limit int) ([]models.UserRole, error)
+	// DeleteRoleById deletes the role and returns the users who held it,
+	// directly or through a role inheriting from it. Unless force is set, it
+	// fails with ErrRoleInUse if there are any such users or roles.
+	DeleteRoleById(ctx context.Context, id string, force bool) ([]string, error)
 }
 
 type gormRoleRepository struct {
@@ -28,10 +50,19 @@ func NewGormRoleRepository(db *gorm.DB) RoleRepository {
 
 func (r *gormRoleRepository) CreateRole(ctx context.Context, data *dto.CreateRoleDto) (*models.Role, error) {
 	role := &models.Role{
-		ID:   uuid.NewString(),
-		Name: data.Name,
+		ID:          uuid.NewString(),
+		Name:        data.Name,
+		Permissions: rolePermissions(data.Permissions),
 	}
-	if err := r.db.WithContext(ctx).Create(role).Error; err != nil {
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(role).Error; err != nil {
+			return err
+		}
+		return createRoleParents(tx, role.ID, data.ParentIds)
+	})
+
+	if err != nil {
 		if errors.Is(err, gorm.ErrDuplicatedKey) {
 			return nil, ErrDuplicateKey
 		}
@@ -44,11 +75,25 @@ func (r *gormRoleRepository) CreateRoles(ctx context.Context, data []dto.CreateR
 	roles := make([]models.Role, len(data))
 	for i := range data {
 		roles[i] = models.Role{
-			ID:   uuid.NewString(),
-			Name: data[i].Name,
+			ID:          uuid.NewString(),
+			Name:        data[i].Name,
+			Permissions: rolePermissions(data[i].Permissions),
 		}
 	}
-	if err := r.db.WithContext(ctx).Create(&roles).Error; err != nil {
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&roles).Error; err != nil {
+			return err
+		}
+		for i := range data {
+			if err := createRoleParents(tx, roles[i].ID, data[i].ParentIds); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
 		if errors.Is(err, gorm.ErrDuplicatedKey) {
 			return nil, ErrDuplicateKey
 		}
@@ -57,6 +102,14 @@ func (r *gormRoleRepository) CreateRoles(ctx context.Context, data []dto.CreateR
 	return roles, nil
 }
 
+func (r *gormRoleRepository) GetRoleById(ctx context.Context, id string) (*models.Role, error) {
+	role := &models.Role{ID: id}
+	if err := r.getRole(ctx, role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
 func (r *gormRoleRepository) GetRoleByName(ctx context.Context, name string) (*models.Role, error) {
 	role := &models.Role{Name: name}
 	if err := r.getRole(ctx, role); err != nil {
@@ -76,13 +129,187 @@ func (r *gormRoleRepository) GetRolesByNames(ctx context.Context, names []string
 	return roles, nil
 }
 
-func (r *gormRoleRepository) DeleteRoleById(ctx context.Context, id string) error {
+func (r *gormRoleRepository) SetRolePermissions(ctx context.Context, roleId string, permissions []string) (*models.Role, error) {
+	role := &models.Role{ID: roleId}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(role).First(role).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrEntityNotFound
+			}
+			return err
+		}
+
+		if err := tx.Where("role_id = ?", roleId).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+
+		role.Permissions = rolePermissions(permissions)
+		for i := range role.Permissions {
+			role.Permissions[i].RoleID = roleId
+		}
+		if len(role.Permissions) == 0 {
+			return nil
+		}
+		return tx.Create(&role.Permissions).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+func (r *gormRoleRepository) SetRoleParents(ctx context.Context, roleId string, parentIds []string) (*models.Role, error) {
+	role := &models.Role{ID: roleId}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(role).First(role).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrEntityNotFound
+			}
+			return err
+		}
+
+		cycle, err := createsRoleCycle(roleId, parentIds, parentsOf(tx))
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return ErrRoleCycle
+		}
+
+		if err := tx.Where("role_id = ?", roleId).Delete(&models.RoleParent{}).Error; err != nil {
+			return err
+		}
+		if err := createRoleParents(tx, roleId, parentIds); err != nil {
+			return err
+		}
+
+		return tx.Preload("Permissions").Preload("Parents").Where(role).First(role).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+func (r *gormRoleRepository) GetEffectiveRoles(ctx context.Context, roleId string) ([]models.Role, error) {
+	return effectiveRoles(r.db.WithContext(ctx), []models.Role{{ID: roleId}})
+}
+
+func (r *gormRoleRepository) UserHasPermission(ctx context.Context, userId string, permission string) (bool, error) {
+	db := r.db.WithContext(ctx)
+
+	var roleIds []string
+	err := db.Model(&models.UserRole{}).
+		Where("user_roles.user_id = ?", userId).
+		Scopes(activeGrants).
+		Pluck("role_id", &roleIds).Error
+	if err != nil {
+		return false, err
+	}
+	if len(roleIds) == 0 {
+		return false, nil
+	}
+
+	roleIds, err = inheritedRoleIds(db, roleIds)
+	if err != nil {
+		return false, err
+	}
+
+	var count int64
+	err = db.Model(&models.RolePermission{}).
+		Where("role_id IN ? AND permission = ?", roleIds, permission).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *gormRoleRepository) ListRoles(ctx context.Context, after string, limit int) ([]models.Role, error) {
+	var roles []models.Role
+	err := r.db.WithContext(ctx).Preload("Permissions").Preload("Parents").
+		Where("name > ?", after).
+		Order("name").
+		Limit(limit).
+		Find(&roles).Error
+	return roles, err
+}
+
+func (r *gormRoleRepository) RenameRole(ctx context.Context, id string, name string) (*models.Role, error) {
 	role := &models.Role{ID: id}
-	return r.deleteRole(ctx, role)
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(role).First(role).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrEntityNotFound
+			}
+			return err
+		}
+		return tx.Model(role).Update("name", name).Error
+	})
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrDuplicateKey
+		}
+		return nil, err
+	}
+	return r.GetRoleById(ctx, id)
+}
+
+func (r *gormRoleRepository) ListRoleGrants(ctx context.Context, roleId string, after string, limit int) ([]models.UserRole, error) {
+	var grants []models.UserRole
+	err := r.db.WithContext(ctx).Preload("User").
+		Where("user_roles.role_id = ? AND user_roles.user_id > ?", roleId, after).
+		Scopes(activeGrants).
+		Order("user_roles.user_id").
+		Limit(limit).
+		Find(&grants).Error
+	return grants, err
+}
+
+func (r *gormRoleRepository) DeleteRoleById(ctx context.Context, id string, force bool) ([]string, error) {
+	var userIds []string
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		roleIds, err := inheritingRoleIds(tx, []string{id})
+		if err != nil {
+			return err
+		}
+		if len(roleIds) > 1 && !force {
+			return ErrRoleInUse
+		}
+
+		err = tx.Model(&models.UserRole{}).
+			Distinct("user_id").
+			Where("user_roles.role_id IN ?", roleIds).
+			Scopes(activeGrants).
+			Pluck("user_id", &userIds).Error
+		if err != nil {
+			return err
+		}
+		if len(userIds) > 0 && !force {
+			return ErrRoleInUse
+		}
+
+		if err := tx.Where("role_id = ?", id).Delete(&models.UserRole{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role_id = ? OR parent_id = ?", id, id).Delete(&models.RoleParent{}).Error; err != nil {
+			return err
+		}
+		return deleteRole(tx, &models.Role{ID: id})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return userIds, nil
 }
 
 func (r *gormRoleRepository) getRole(ctx context.Context, role *models.Role) error {
-	if err := r.db.WithContext(ctx).Where(role).First(role).Error; err != nil {
+	if err := r.db.WithContext(ctx).Preload("Permissions").Preload("Parents").Where(role).First(role).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return ErrEntityNotFound
 		}
@@ -92,7 +319,7 @@ func (r *gormRoleRepository) getRole(ctx context.Context, role *models.Role) err
 }
 
 func (r *gormRoleRepository) getRoles(ctx context.Context, roles *[]models.Role) error {
-	if err := r.db.WithContext(ctx).Where(roles).Find(roles).Error; err != nil {
+	if err := r.db.WithContext(ctx).Preload("Permissions").Preload("Parents").Where(roles).Find(roles).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return ErrEntityNotFound
 		}
@@ -101,8 +328,8 @@ func (r *gormRoleRepository) getRoles(ctx context.Context, roles *[]models.Role)
 	return nil
 }
 
-func (r *gormRoleRepository) deleteRole(ctx context.Context, role *models.Role) error {
-	result := r.db.WithContext(ctx).Delete(&role)
+func deleteRole(tx *gorm.DB, role *models.Role) error {
+	result := tx.Delete(&role)
 	if result.Error != nil {
 		return result.Error
 	}
@@ -111,3 +338,11 @@ func (r *gormRoleRepository) deleteRole(ctx context.Context, role *models.Role)
 	}
 	return nil
 }
+
+func rolePermissions(permissions []string) []models.RolePermission {
+	rolePermissions := make([]models.RolePermission, len(permissions))
+	for i, permission := range permissions {
+		rolePermissions[i] = models.RolePermission{Permission: permission}
+	}
+	return rolePermissions
+}
@@ -3,18 +3,28 @@ package repository
 import (
 	"context"
 	"errors"
+	"time"
 	"user-service/dto"
 	"user-service/models"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserRepository interface {
 	CreateUser(ctx context.Context, data *dto.CreateUserDto) (string, error)
 	GetUserById(ctx context.Context, id string) (*models.User, error)
 	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
-	AssignRole(ctx context.Context, userId string, role *models.Role) error
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	// AssignRole grants a role, replacing the expiry of an existing grant.
+	AssignRole(ctx context.Context, data *dto.AssignRoleDto) error
+	RevokeRole(ctx context.Context, userId string, roleId string) error
+	// ExpiredRoleGrantUsers returns the users holding grants that expired
+	// before the given time.
+	ExpiredRoleGrantUsers(ctx context.Context, before time.Time) ([]string, error)
+	DeleteExpiredRoleGrants(ctx context.Context, userId string, before time.Time) error
+	UpdatePassword(ctx context.Context, userId string, hashedPassword string) error
 	DeleteUserById(ctx context.Context, id string) error
 }
 
@@ -31,6 +41,7 @@ func (r *gormUserRepository) CreateUser(ctx context.Context, data *dto.CreateUse
 		ID:       uuid.NewString(),
 		Name:     data.Name,
 		Username: data.Username,
+		Email:    data.Email,
 		Password: data.Password,
 	}
 	if err := r.db.WithContext(ctx).Create(user).Error; err != nil {
@@ -58,32 +69,93 @@ func (r *gormUserRepository) GetUserByUsername(ctx context.Context, username str
 	return user, nil
 }
 
-func (r *gormUserRepository) AssignRole(ctx context.Context, userId string, role *models.Role) error {
+func (r *gormUserRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	user := &models.User{Email: &email}
+	if err := r.getUser(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *gormUserRepository) AssignRole(ctx context.Context, data *dto.AssignRoleDto) error {
 	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		user := &models.User{ID: userId}
-		if err := tx.Preload("Roles").Where(user).First(user).Error; err != nil {
+		user := &models.User{ID: data.UserID}
+		if err := tx.Where(user).First(user).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				return ErrEntityNotFound
 			}
 			return err
 		}
 
-		return tx.Model(user).Association("Roles").Append(role)
+		grant := &models.UserRole{
+			UserID:    data.UserID,
+			RoleID:    data.RoleID,
+			GrantedBy: data.GrantedBy,
+			GrantedAt: time.Now(),
+			ExpiresAt: data.ExpiresAt,
+		}
+		return tx.Omit("User", "Role").
+			Clauses(clause.OnConflict{DoUpdates: clause.AssignmentColumns([]string{"granted_by", "granted_at", "expires_at"})}).
+			Create(grant).Error
 	})
 }
 
+func (r *gormUserRepository) RevokeRole(ctx context.Context, userId string, roleId string) error {
+	result := r.db.WithContext(ctx).
+		Where("user_id = ? AND role_id = ?", userId, roleId).
+		Delete(&models.UserRole{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrEntityNotFound
+	}
+	return nil
+}
+
+func (r *gormUserRepository) ExpiredRoleGrantUsers(ctx context.Context, before time.Time) ([]string, error) {
+	var userIds []string
+	err := r.db.WithContext(ctx).Model(&models.UserRole{}).
+		Where("expires_at <= ?", before).
+		Distinct().Pluck("user_id", &userIds).Error
+	return userIds, err
+}
+
+func (r *gormUserRepository) DeleteExpiredRoleGrants(ctx context.Context, userId string, before time.Time) error {
+	return r.db.WithContext(ctx).
+		Where("user_id = ? AND expires_at <= ?", userId, before).
+		Delete(&models.UserRole{}).Error
+}
+
+func (r *gormUserRepository) UpdatePassword(ctx context.Context, userId string, hashedPassword string) error {
+	result := r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", userId).Update("password", hashedPassword)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrEntityNotFound
+	}
+	return nil
+}
+
 func (r *gormUserRepository) UpdateUserById(ctx context.Context, id string, data *dto.UpdateUserDto) (*models.User, error) {
 	var user *models.User
 
 	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		user = &models.User{ID: id}
-		if err := tx.Preload("Roles").Where(user).First(user).Error; err != nil {
+		if err := tx.Where(user).First(user).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				return ErrEntityNotFound
 			}
 			return err
 		}
 
+		roles, err := grantedRoles(tx, user.ID)
+		if err != nil {
+			return err
+		}
+		user.Roles = roles
+
 		if data.Name != nil {
 			user.Name = *data.Name
 		}
@@ -116,11 +188,22 @@ func (r *gormUserRepository) DeleteUserById(ctx context.Context, id string) erro
 	return nil
 }
 
+// getUser loads the user with its effective roles: those granted to it and
+// not yet expired, plus every role they inherit.
 func (r *gormUserRepository) getUser(ctx context.Context, user *models.User) error {
-	err := r.db.WithContext(ctx).Preload("Roles").Where(&user).First(&user).Error
+	db := r.db.WithContext(ctx)
+	err := db.Where(&user).First(&user).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return ErrEntityNotFound
+	} else if err != nil {
+		return err
+	}
+
+	roles, err := grantedRoles(db, user.ID)
+	if err != nil {
+		return err
 	}
+	user.Roles, err = effectiveRoles(db, roles)
 	return err
 }
 
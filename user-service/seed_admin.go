@@ -1,23 +1,32 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"user-service/hasher"
 	"user-service/models"
+	"user-service/service"
 	"user-service/utils"
 
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
-func SeedAdmin(db *gorm.DB) error {
-	adminRole := models.Role{Name: "ADMIN"}
+func SeedAdmin(db *gorm.DB, hasher hasher.Hasher) error {
+	adminRole := models.Role{Name: service.AdminRole}
 
-	if err := db.FirstOrCreate(&adminRole, models.Role{Name: "ADMIN"}).Error; err != nil {
+	if err := db.FirstOrCreate(&adminRole, models.Role{Name: service.AdminRole}).Error; err != nil {
 		return fmt.Errorf("failed to seed admin role: %w", err)
 	}
 
+	for _, permission := range service.AdminPermissions {
+		grant := models.RolePermission{RoleID: adminRole.ID, Permission: permission}
+		if err := db.FirstOrCreate(&grant, grant).Error; err != nil {
+			return fmt.Errorf("failed to seed admin permissions: %w", err)
+		}
+	}
+
 	adminPassword := utils.GetEnv("ADMIN_PASSWORD", "admin")
-	hashedAdminPassword, err := bcrypt.GenerateFromPassword([]byte(adminPassword), bcrypt.DefaultCost)
+	hashedAdminPassword, err := hasher.Hash(context.Background(), adminPassword)
 
 	if err != nil {
 		return fmt.Errorf("failed to hash admin password: %w", err)
@@ -26,7 +35,7 @@ func SeedAdmin(db *gorm.DB) error {
 	adminUser := models.User{
 		Username: "admin",
 		Name:     "Admin",
-		Password: string(hashedAdminPassword),
+		Password: hashedAdminPassword,
 		Roles:    []models.Role{adminRole},
 	}
 
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"authkit/authclient"
+	"authkit/serviceauth"
+	pb "user-service/pb"
+	"user-service/service"
+)
+
+const (
+	authService = "auth-service"
+	gateway     = "gateway"
+)
+
+// Policy lists which services may call each RPC of user-service.
+var Policy = serviceauth.Policy{
+	pb.UserService_CreateUser_FullMethodName:        {gateway},
+	pb.UserService_GetUserById_FullMethodName:       {gateway, authService},
+	pb.UserService_GetUserByUsername_FullMethodName: {gateway, authService},
+	pb.UserService_GetUserByEmail_FullMethodName:    {authService},
+	pb.UserService_ProvisionUser_FullMethodName:     {authService},
+	pb.UserService_GetCredentials_FullMethodName:    {authService},
+	pb.UserService_VerifyPassword_FullMethodName:    {authService},
+	pb.UserService_SetPassword_FullMethodName:       {authService},
+	pb.UserService_ChangePassword_FullMethodName:    {gateway},
+	pb.UserService_DeleteUser_FullMethodName:        {gateway},
+	pb.UserService_AssignRole_FullMethodName:        {gateway},
+	pb.UserService_RevokeRole_FullMethodName:        {gateway},
+	pb.RoleService_CheckPermission_FullMethodName:   {gateway, authService},
+	"/user.RoleService/*":                           {gateway},
+}
+
+var (
+	adminOnly    = authclient.Rule{Roles: []string{service.AdminRole}}
+	assignRoles  = adminOr(service.PermissionRoleAssign)
+	authOnly     = authclient.Rule{Services: []string{authService}}
+	anyUser      = authclient.Rule{Authenticated: true}
+	userOrAuth   = authclient.Rule{Services: []string{authService}, Authenticated: true}
+	registration = authclient.Rule{Public: true}
+)
+
+// AccessPolicy lists which users may call each RPC of user-service. It is
+// enforced after Policy, on the access token the caller forwards.
+var AccessPolicy = authclient.AccessPolicy{
+	pb.UserService_CreateUser_FullMethodName:        registration,
+	pb.UserService_GetUserById_FullMethodName:       userOrAuth,
+	pb.UserService_GetUserByUsername_FullMethodName: userOrAuth,
+	pb.UserService_GetUserByEmail_FullMethodName:    authOnly,
+	pb.UserService_ProvisionUser_FullMethodName:     authOnly,
+	pb.UserService_GetCredentials_FullMethodName:    authOnly,
+	pb.UserService_VerifyPassword_FullMethodName:    authOnly,
+	pb.UserService_SetPassword_FullMethodName:       authOnly,
+	pb.UserService_ChangePassword_FullMethodName:    anyUser,
+	pb.UserService_DeleteUser_FullMethodName: {
+		Roles:       []string{service.AdminRole},
+		Permissions: []string{service.PermissionUserDelete},
+		Self:        requestUserID((*pb.DeleteUserRequest).GetId),
+	},
+	pb.UserService_AssignRole_FullMethodName: assignRoles,
+	pb.UserService_RevokeRole_FullMethodName: assignRoles,
+	pb.RoleService_CheckPermission_FullMethodName: {
+		Services: []string{authService},
+		Roles:    []string{service.AdminRole},
+		Self:     requestUserID((*pb.CheckPermissionRequest).GetUserId),
+	},
+	// Editing roles changes what every holder may do, so it stays with
+	// admins rather than being delegated.
+	"/user.RoleService/*": adminOnly,
+}
+
+// adminOr lets through admins and users granted permission. Admins are let
+// through by role as well so that editing the ADMIN role's permissions cannot
+// lock them out.
+func adminOr(permission string) authclient.Rule {
+	return authclient.Rule{
+		Roles:       []string{service.AdminRole},
+		Permissions: []string{permission},
+	}
+}
+
+// requestUserID adapts a request getter for use as Rule.Self.
+func requestUserID[T any](get func(T) string) func(any) string {
+	return func(req any) string {
+		r, ok := req.(T)
+		if !ok {
+			return ""
+		}
+		return get(r)
+	}
+}
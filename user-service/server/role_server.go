@@ -3,8 +3,11 @@ package server
 import (
 	"context"
 	"user-service/dto"
+	"user-service/models"
 	"user-service/pb"
 	"user-service/service"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type RoleServer struct {
@@ -18,9 +21,10 @@ func NewRoleServer(roleService service.RoleService) *RoleServer {
 
 func (s *RoleServer) CreateRole(ctx context.Context, req *pb.CreateRoleRequest) (*pb.CreateRoleResponse, error) {
 	data := &dto.CreateRoleDto{
-		Name: req.GetName(),
+		Name:        req.GetName(),
+		Permissions: req.GetPermissions(),
 	}
-	role, err := s.roleService.CreateRole(ctx, data)
+	role, err := s.roleService.CreateRole(ctx, data, req.GetParents())
 	if err != nil {
 		return nil, err
 	}
@@ -51,12 +55,7 @@ func (s *RoleServer) GetRoleByName(ctx context.Context, req *pb.GetRoleByNameReq
 	if err != nil {
 		return nil, err
 	}
-	return &pb.GetRoleByNameResponse{
-		Role: &pb.Role{
-			Id:   role.ID,
-			Name: role.Name,
-		},
-	}, nil
+	return &pb.GetRoleByNameResponse{Role: mapRoleToPbRole(role)}, nil
 }
 
 func (s *RoleServer) GetRolesByNames(ctx context.Context, req *pb.GetRolesByNamesRequest) (*pb.GetRolesByNamesResponse, error) {
@@ -67,20 +66,92 @@ func (s *RoleServer) GetRolesByNames(ctx context.Context, req *pb.GetRolesByName
 
 	rolesResponse := &pb.GetRolesByNamesResponse{}
 	rolesResponse.Roles = make([]*pb.Role, len(roles))
-	for i, role := range roles {
-		rolesResponse.Roles[i] = &pb.Role{
-			Id:   role.ID,
-			Name: role.Name,
-		}
+	for i := range roles {
+		rolesResponse.Roles[i] = mapRoleToPbRole(&roles[i])
 	}
 
 	return rolesResponse, nil
 }
 
 func (s *RoleServer) DeleteRoleById(ctx context.Context, req *pb.DeleteRoleByIdRequest) (*pb.DeleteRoleResponse, error) {
-	err := s.roleService.DeleteRoleById(ctx, req.GetId())
+	err := s.roleService.DeleteRoleById(ctx, req.GetId(), req.GetForce())
 	if err != nil {
 		return nil, err
 	}
 	return &pb.DeleteRoleResponse{}, nil
 }
+
+func (s *RoleServer) GetRoleById(ctx context.Context, req *pb.GetRoleByIdRequest) (*pb.GetRoleByIdResponse, error) {
+	role, err := s.roleService.GetRoleById(ctx, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetRoleByIdResponse{Role: mapRoleToPbRole(role)}, nil
+}
+
+func (s *RoleServer) SetRolePermissions(ctx context.Context, req *pb.SetRolePermissionsRequest) (*pb.SetRolePermissionsResponse, error) {
+	role, err := s.roleService.SetRolePermissions(ctx, req.GetRoleId(), req.GetPermissions())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.SetRolePermissionsResponse{Role: mapRoleToPbRole(role)}, nil
+}
+
+func (s *RoleServer) SetRoleParents(ctx context.Context, req *pb.SetRoleParentsRequest) (*pb.SetRoleParentsResponse, error) {
+	role, err := s.roleService.SetRoleParents(ctx, req.GetRoleId(), req.GetParents())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.SetRoleParentsResponse{Role: mapRoleToPbRole(role)}, nil
+}
+
+func (s *RoleServer) CheckPermission(ctx context.Context, req *pb.CheckPermissionRequest) (*pb.CheckPermissionResponse, error) {
+	allowed, err := s.roleService.CheckPermission(ctx, req.GetUserId(), req.GetPermission())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CheckPermissionResponse{Allowed: allowed}, nil
+}
+
+func (s *RoleServer) ListRoles(ctx context.Context, req *pb.ListRolesRequest) (*pb.ListRolesResponse, error) {
+	roles, nextPageToken, err := s.roleService.ListRoles(ctx, req.GetPageSize(), req.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ListRolesResponse{Roles: mapRolesToPbRoles(roles), NextPageToken: nextPageToken}, nil
+}
+
+func (s *RoleServer) RenameRole(ctx context.Context, req *pb.RenameRoleRequest) (*pb.RenameRoleResponse, error) {
+	role, err := s.roleService.RenameRole(ctx, req.GetId(), req.GetName())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.RenameRoleResponse{Role: mapRoleToPbRole(role)}, nil
+}
+
+func (s *RoleServer) ListUsersInRole(ctx context.Context, req *pb.ListUsersInRoleRequest) (*pb.ListUsersInRoleResponse, error) {
+	grants, nextPageToken, err := s.roleService.ListUsersInRole(ctx, req.GetRoleId(), req.GetPageSize(), req.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]*pb.RoleMember, len(grants))
+	for i := range grants {
+		members[i] = mapRoleGrantToPbRoleMember(&grants[i])
+	}
+	return &pb.ListUsersInRoleResponse{Members: members, NextPageToken: nextPageToken}, nil
+}
+
+func mapRoleGrantToPbRoleMember(grant *models.UserRole) *pb.RoleMember {
+	member := &pb.RoleMember{
+		UserId:    grant.UserID,
+		Username:  grant.User.Username,
+		Name:      grant.User.Name,
+		GrantedBy: grant.GrantedBy,
+		GrantedAt: timestamppb.New(grant.GrantedAt),
+	}
+	if grant.ExpiresAt != nil {
+		member.ExpiresAt = timestamppb.New(*grant.ExpiresAt)
+	}
+	return member
+}
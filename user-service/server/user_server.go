@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"time"
 	"user-service/dto"
 	"user-service/models"
 	"user-service/pb"
@@ -23,6 +24,9 @@ func (s *UserServer) CreateUser(ctx context.Context, req *pb.CreateUserRequest)
 		Username: req.GetUsername(),
 		Password: req.GetPassword(),
 	}
+	if email := req.GetEmail(); email != "" {
+		data.Email = &email
+	}
 	userId, err := s.userService.RegisterUser(ctx, data)
 	if err != nil {
 		return nil, err
@@ -46,6 +50,40 @@ func (s *UserServer) GetUserByUsername(ctx context.Context, req *pb.GetUserByUse
 	return &pb.GetUserResponse{User: mapUserToPbUser(user)}, nil
 }
 
+func (s *UserServer) GetUserByEmail(ctx context.Context, req *pb.GetUserByEmailRequest) (*pb.GetUserResponse, error) {
+	user, err := s.userService.GetUserByEmail(ctx, req.GetEmail())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetUserResponse{User: mapUserToPbUser(user)}, nil
+}
+
+func (s *UserServer) ProvisionUser(ctx context.Context, req *pb.ProvisionUserRequest) (*pb.CreateUserResponse, error) {
+	data := &dto.CreateUserDto{
+		Name:     req.GetName(),
+		Username: req.GetUsername(),
+	}
+	if email := req.GetEmail(); email != "" {
+		data.Email = &email
+	}
+
+	userId, err := s.userService.ProvisionUser(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CreateUserResponse{Id: userId}, nil
+}
+
+func (s *UserServer) VerifyPassword(ctx context.Context, req *pb.VerifyPasswordRequest) (*pb.VerifyPasswordResponse, error) {
+	user, err := s.userService.VerifyPassword(ctx, req.GetUsername(), req.GetPassword())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.VerifyPasswordResponse{User: mapUserToPbUser(user)}, nil
+}
+
+// Deprecated: GetCredentials is kept for clients that have not moved to
+// VerifyPassword yet.
 func (s *UserServer) GetCredentials(ctx context.Context, req *pb.GetCredentialsRequest) (*pb.GetCredentialsResponse, error) {
 	user, err := s.userService.GetUserByUsername(ctx, req.GetUsername())
 	if err != nil {
@@ -57,6 +95,20 @@ func (s *UserServer) GetCredentials(ctx context.Context, req *pb.GetCredentialsR
 	}, nil
 }
 
+func (s *UserServer) SetPassword(ctx context.Context, req *pb.SetPasswordRequest) (*pb.SetPasswordResponse, error) {
+	if err := s.userService.SetPassword(ctx, req.GetUserId(), req.GetPassword()); err != nil {
+		return nil, err
+	}
+	return &pb.SetPasswordResponse{}, nil
+}
+
+func (s *UserServer) ChangePassword(ctx context.Context, req *pb.ChangePasswordRequest) (*pb.ChangePasswordResponse, error) {
+	if err := s.userService.ChangePassword(ctx, req.GetCurrentPassword(), req.GetNewPassword()); err != nil {
+		return nil, err
+	}
+	return &pb.ChangePasswordResponse{}, nil
+}
+
 func (s *UserServer) DeleteUser(ctx context.Context, req *pb.DeleteUserRequest) (*pb.DeleteUserResponse, error) {
 	if err := s.userService.DeleteUserById(ctx, req.GetId()); err != nil {
 		return nil, err
@@ -65,26 +117,55 @@ func (s *UserServer) DeleteUser(ctx context.Context, req *pb.DeleteUserRequest)
 }
 
 func (s *UserServer) AssignRole(ctx context.Context, req *pb.AssignRoleRequest) (*pb.AssignRoleResponse, error) {
-	if err := s.userService.AssignRole(ctx, req.GetUserId(), req.GetRoleName()); err != nil {
+	var expiresAt *time.Time
+	if req.GetExpiresAt() != nil {
+		t := req.GetExpiresAt().AsTime()
+		expiresAt = &t
+	}
+
+	if err := s.userService.AssignRole(ctx, req.GetUserId(), req.GetRoleName(), expiresAt); err != nil {
 		return nil, err
 	}
 	return &pb.AssignRoleResponse{}, nil
 }
 
+func (s *UserServer) RevokeRole(ctx context.Context, req *pb.RevokeRoleRequest) (*pb.RevokeRoleResponse, error) {
+	if err := s.userService.RevokeRole(ctx, req.GetUserId(), req.GetRoleName()); err != nil {
+		return nil, err
+	}
+	return &pb.RevokeRoleResponse{}, nil
+}
+
 func mapUserToPbUser(user *models.User) *pb.User {
 	return &pb.User{
 		Id:       user.ID,
 		Name:     user.Name,
 		Username: user.Username,
+		Email:    stringValue(user.Email),
 		Roles:    mapRolesToPbRoles(user.Roles),
 	}
 }
 
 func mapRolesToPbRoles(roles []models.Role) []*pb.Role {
 	pbRoles := make([]*pb.Role, 0, len(roles))
-	for _, r := range roles {
-		pbRole := &pb.Role{Id: r.ID, Name: r.Name}
-		pbRoles = append(pbRoles, pbRole)
+	for i := range roles {
+		pbRoles = append(pbRoles, mapRoleToPbRole(&roles[i]))
 	}
 	return pbRoles
 }
+
+func mapRoleToPbRole(role *models.Role) *pb.Role {
+	return &pb.Role{
+		Id:          role.ID,
+		Name:        role.Name,
+		Permissions: role.PermissionNames(),
+		Parents:     role.ParentNames(),
+	}
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
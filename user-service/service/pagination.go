@@ -0,0 +1,35 @@
+package service
+
+import (
+	"encoding/base64"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// pageSize clamps a requested page size, using the default when unset.
+func pageSize(requested int32) int {
+	if requested <= 0 {
+		return defaultPageSize
+	}
+	return min(int(requested), maxPageSize)
+}
+
+// Page tokens wrap the sort key of the last item returned, so that pages stay
+// stable while items are added or removed.
+func encodePageToken(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func decodePageToken(token string) (string, error) {
+	key, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", status.Error(codes.InvalidArgument, "invalid page token.")
+	}
+	return string(key), nil
+}
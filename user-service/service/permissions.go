@@ -0,0 +1,38 @@
+package service
+
+import (
+	"regexp"
+	"slices"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Permissions checked by the services of this repository. Roles may also be
+// granted permissions defined elsewhere, as long as the names are well formed.
+const (
+	PermissionUserDelete = "user.delete"
+	PermissionRoleAssign = "role.assign"
+)
+
+// AdminPermissions are granted to the ADMIN role when the service starts.
+var AdminPermissions = []string{
+	PermissionUserDelete,
+	PermissionRoleAssign,
+}
+
+var permissionPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*(\.[a-z][a-z0-9_]*)+$`)
+
+// normalizePermissions validates permission names and drops duplicates.
+func normalizePermissions(permissions []string) ([]string, error) {
+	normalized := make([]string, 0, len(permissions))
+	for _, permission := range permissions {
+		if len(permission) > 128 || !permissionPattern.MatchString(permission) {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid permission %q", permission)
+		}
+		if !slices.Contains(normalized, permission) {
+			normalized = append(normalized, permission)
+		}
+	}
+	return normalized, nil
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"authkit/authclient"
+	"user-service/config"
+	"user-service/repository"
+)
+
+// RoleGrantSweeper deletes expired role grants. Expired grants are already
+// ignored when users are loaded, but access tokens issued before the expiry
+// still carry the role, so auth-service is asked to revoke them first. A grant
+// is only deleted once that succeeded, leaving failures for the next sweep.
+// Sweeping from several replicas at once is harmless.
+type RoleGrantSweeper struct {
+	repository repository.UserRepository
+	authClient *authclient.Client
+	interval   time.Duration
+}
+
+func NewRoleGrantSweeper(repository repository.UserRepository, authClient *authclient.Client, cfg *config.Config) *RoleGrantSweeper {
+	return &RoleGrantSweeper{
+		repository: repository,
+		authClient: authClient,
+		interval:   cfg.RoleGrantSweepInterval,
+	}
+}
+
+// Run sweeps on every interval until ctx is done.
+func (t *RoleGrantSweeper) Run(ctx context.Context) {
+	if t.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.sweep(ctx)
+		}
+	}
+}
+
+func (t *RoleGrantSweeper) sweep(ctx context.Context) {
+	now := time.Now()
+
+	userIds, err := t.repository.ExpiredRoleGrantUsers(ctx, now)
+	if err != nil {
+		log.Printf("failed to list expired role grants: %v", err)
+		return
+	}
+
+	for _, userId := range userIds {
+		if err := t.authClient.RevokeAccessTokens(ctx, userId); err != nil {
+			log.Printf("failed to revoke access tokens of user %s: %v", userId, err)
+			continue
+		}
+		if err := t.repository.DeleteExpiredRoleGrants(ctx, userId, now); err != nil {
+			log.Printf("failed to delete expired role grants of user %s: %v", userId, err)
+			continue
+		}
+		log.Printf("removed expired role grants of user %s", userId)
+	}
+}
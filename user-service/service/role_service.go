@@ -1,37 +1,79 @@
 package service
 
 import (
+	"authkit/authclient"
 	"context"
 	"errors"
 	"log"
+	"slices"
 	"user-service/dto"
 	"user-service/models"
 	"user-service/repository"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
-	"gorm.io/gorm"
 )
 
 type RoleService interface {
-	CreateRole(ctx context.Context, role *dto.CreateRoleDto) (*models.Role, error)
+	CreateRole(ctx context.Context, role *dto.CreateRoleDto, parentNames []string) (*models.Role, error)
 	CreateRoles(ctx context.Context, roles []dto.CreateRoleDto) ([]models.Role, error)
+	GetRoleById(ctx context.Context, id string) (*models.Role, error)
 	GetRoleByName(ctx context.Context, name string) (*models.Role, error)
 	GetRolesByNames(ctx context.Context, names []string) ([]models.Role, error)
-	DeleteRoleById(ctx context.Context, id string) error
+	SetRolePermissions(ctx context.Context, id string, permissions []string) (*models.Role, error)
+	SetRoleParents(ctx context.Context, id string, parentNames []string) (*models.Role, error)
+	CheckPermission(ctx context.Context, userId string, permission string) (bool, error)
+	GetAssignableRole(ctx context.Context, caller *authclient.Claims, name string) (*models.Role, error)
+	ListRoles(ctx context.Context, pageSize int32, pageToken string) ([]models.Role, string, error)
+	RenameRole(ctx context.Context, id string, name string) (*models.Role, error)
+	ListUsersInRole(ctx context.Context, roleId string, pageSize int32, pageToken string) ([]models.UserRole, string, error)
+	DeleteRoleById(ctx context.Context, id string, force bool) error
+}
+
+// AdminRole is seeded at startup and checked by name across services, so it
+// cannot be renamed, no other role may take its name and only admins may
+// delete it, by force.
+const AdminRole = "ADMIN"
+
+func checkRoleName(name string) error {
+	if name == AdminRole {
+		return status.Errorf(codes.InvalidArgument, "the %s role name is reserved", AdminRole)
+	}
+	return nil
 }
 
 type roleService struct {
 	repository repository.RoleRepository
+	authClient *authclient.Client
 }
 
-func NewRoleService(repository repository.RoleRepository) RoleService {
+func NewRoleService(repository repository.RoleRepository, authClient *authclient.Client) RoleService {
 	return &roleService{
 		repository: repository,
+		authClient: authClient,
 	}
 }
 
-func (s *roleService) CreateRole(ctx context.Context, data *dto.CreateRoleDto) (*models.Role, error) {
+// CreateRole creates a role granting data.Permissions and inheriting the roles
+// named by parentNames.
+func (s *roleService) CreateRole(ctx context.Context, data *dto.CreateRoleDto, parentNames []string) (*models.Role, error) {
+	if err := checkRoleName(data.Name); err != nil {
+		return nil, err
+	}
+	permissions, err := normalizePermissions(data.Permissions)
+	if err != nil {
+		return nil, err
+	}
+	data.Permissions = permissions
+
+	if slices.Contains(parentNames, data.Name) {
+		return nil, status.Error(codes.InvalidArgument, "a role cannot inherit itself")
+	}
+	data.ParentIds, err = s.resolveRoleIds(ctx, parentNames)
+	if err != nil {
+		return nil, err
+	}
+
 	roles, err := s.repository.CreateRole(ctx, data)
 	if err != nil {
 		if errors.Is(err, repository.ErrDuplicateKey) {
@@ -44,6 +86,17 @@ func (s *roleService) CreateRole(ctx context.Context, data *dto.CreateRoleDto) (
 }
 
 func (s *roleService) CreateRoles(ctx context.Context, data []dto.CreateRoleDto) ([]models.Role, error) {
+	for i := range data {
+		if err := checkRoleName(data[i].Name); err != nil {
+			return nil, err
+		}
+		permissions, err := normalizePermissions(data[i].Permissions)
+		if err != nil {
+			return nil, err
+		}
+		data[i].Permissions = permissions
+	}
+
 	roles, err := s.repository.CreateRoles(ctx, data)
 	if err != nil {
 		if errors.Is(err, repository.ErrDuplicateKey) {
@@ -55,12 +108,22 @@ func (s *roleService) CreateRoles(ctx context.Context, data []dto.CreateRoleDto)
 	return roles, nil
 }
 
+func (s *roleService) GetRoleById(ctx context.Context, id string) (*models.Role, error) {
+	role, err := s.repository.GetRoleById(ctx, id)
+	if errors.Is(err, repository.ErrEntityNotFound) {
+		return nil, status.Error(codes.NotFound, "role not found.")
+	} else if err != nil {
+		log.Printf("failed to get role by id: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to get role by id")
+	}
+	return role, nil
+}
+
 func (s *roleService) GetRoleByName(ctx context.Context, name string) (*models.Role, error) {
 	role, err := s.repository.GetRoleByName(ctx, name)
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, status.Error(codes.NotFound, "role not found.")
-		}
+	if errors.Is(err, repository.ErrEntityNotFound) {
+		return nil, status.Error(codes.NotFound, "role not found.")
+	} else if err != nil {
 		log.Printf("failed to get role by name: %v", err)
 		return nil, status.Errorf(codes.Internal, "failed to get role by name")
 	}
@@ -76,10 +139,225 @@ func (s *roleService) GetRolesByNames(ctx context.Context, names []string) ([]mo
 	return roles, nil
 }
 
-func (s *roleService) DeleteRoleById(ctx context.Context, id string) error {
-	if err := s.repository.DeleteRoleById(ctx, id); err != nil {
+func (s *roleService) SetRolePermissions(ctx context.Context, id string, permissions []string) (*models.Role, error) {
+	permissions, err := normalizePermissions(permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := s.repository.SetRolePermissions(ctx, id, permissions)
+	if errors.Is(err, repository.ErrEntityNotFound) {
+		return nil, status.Error(codes.NotFound, "role not found.")
+	} else if err != nil {
+		log.Printf("failed to set role permissions: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to set role permissions")
+	}
+	return role, nil
+}
+
+// SetRoleParents replaces the roles the role inherits. Changes that would make
+// a role inherit itself, directly or through other roles, are rejected.
+func (s *roleService) SetRoleParents(ctx context.Context, id string, parentNames []string) (*models.Role, error) {
+	parentIds, err := s.resolveRoleIds(ctx, parentNames)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := s.repository.SetRoleParents(ctx, id, parentIds)
+	if errors.Is(err, repository.ErrEntityNotFound) {
+		return nil, status.Error(codes.NotFound, "role not found.")
+	} else if errors.Is(err, repository.ErrRoleCycle) {
+		return nil, status.Error(codes.FailedPrecondition, "role hierarchy would contain a cycle")
+	} else if err != nil {
+		log.Printf("failed to set role parents: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to set role parents")
+	}
+	return role, nil
+}
+
+// CheckPermission reports whether any of the user's roles, directly held or
+// inherited, grants permission.
+// Unknown users have no permissions.
+func (s *roleService) CheckPermission(ctx context.Context, userId string, permission string) (bool, error) {
+	if userId == "" || permission == "" {
+		return false, status.Error(codes.InvalidArgument, "user id and permission are required.")
+	}
+
+	allowed, err := s.repository.UserHasPermission(ctx, userId, permission)
+	if err != nil {
+		log.Printf("failed to check permission: %v", err)
+		return false, status.Errorf(codes.Internal, "failed to check permission")
+	}
+	return allowed, nil
+}
+
+// GetAssignableRole returns the role named name if the caller may grant or
+// revoke it. Admins may hand out any role. Other callers, such as holders of
+// role.assign, may only hand out roles that neither are nor inherit ADMIN and
+// grant no permission the caller lacks, so they cannot escalate.
+func (s *roleService) GetAssignableRole(ctx context.Context, caller *authclient.Claims, name string) (*models.Role, error) {
+	role, err := s.GetRoleByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if caller.HasRole(AdminRole) {
+		return role, nil
+	}
+
+	roles, err := s.repository.GetEffectiveRoles(ctx, role.ID)
+	if err != nil {
+		log.Printf("failed to get effective roles: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to get role")
+	}
+	for _, r := range roles {
+		if r.Name == AdminRole {
+			return nil, status.Errorf(codes.PermissionDenied, "only admins may grant or revoke the %s role", AdminRole)
+		}
+		for _, p := range r.Permissions {
+			if !caller.HasPermission(p.Permission) {
+				return nil, status.Errorf(codes.PermissionDenied, "role %s grants %s, which you do not hold", name, p.Permission)
+			}
+		}
+	}
+	return role, nil
+}
+
+// resolveRoleIds maps role names to ids, failing if any name is unknown.
+func (s *roleService) resolveRoleIds(ctx context.Context, names []string) ([]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	names = slices.Compact(slices.Sorted(slices.Values(names)))
+
+	roles, err := s.repository.GetRolesByNames(ctx, names)
+	if err != nil {
+		log.Printf("failed to get roles by names: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to resolve roles")
+	}
+
+	ids := make([]string, 0, len(roles))
+	for _, name := range names {
+		i := slices.IndexFunc(roles, func(role models.Role) bool { return role.Name == name })
+		if i < 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown role %q", name)
+		}
+		ids = append(ids, roles[i].ID)
+	}
+	return ids, nil
+}
+
+func (s *roleService) ListRoles(ctx context.Context, size int32, pageToken string) ([]models.Role, string, error) {
+	after, err := decodePageToken(pageToken)
+	if err != nil {
+		return nil, "", err
+	}
+
+	limit := pageSize(size)
+	roles, err := s.repository.ListRoles(ctx, after, limit+1)
+	if err != nil {
+		log.Printf("failed to list roles: %v", err)
+		return nil, "", status.Errorf(codes.Internal, "failed to list roles")
+	}
+
+	if len(roles) <= limit {
+		return roles, "", nil
+	}
+	roles = roles[:limit]
+	return roles, encodePageToken(roles[limit-1].Name), nil
+}
+
+// RenameRole renames a role. Access tokens already issued keep the old name
+// until they are refreshed.
+func (s *roleService) RenameRole(ctx context.Context, id string, name string) (*models.Role, error) {
+	if name == "" {
+		return nil, status.Error(codes.InvalidArgument, "role name is required.")
+	}
+	if err := checkRoleName(name); err != nil {
+		return nil, err
+	}
+
+	role, err := s.GetRoleById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if role.Name == AdminRole {
+		return nil, status.Errorf(codes.FailedPrecondition, "the %s role cannot be renamed", AdminRole)
+	}
+
+	role, err = s.repository.RenameRole(ctx, id, name)
+	if errors.Is(err, repository.ErrEntityNotFound) {
+		return nil, status.Error(codes.NotFound, "role not found.")
+	} else if errors.Is(err, repository.ErrDuplicateKey) {
+		return nil, status.Errorf(codes.AlreadyExists, "Role with name %s already exists", name)
+	} else if err != nil {
+		log.Printf("failed to rename role: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to rename role")
+	}
+	return role, nil
+}
+
+// ListUsersInRole returns the unexpired grants of the role, with their users
+// loaded. Users who only inherit the role through another one are not listed.
+func (s *roleService) ListUsersInRole(ctx context.Context, roleId string, size int32, pageToken string) ([]models.UserRole, string, error) {
+	after, err := decodePageToken(pageToken)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if _, err := s.GetRoleById(ctx, roleId); err != nil {
+		return nil, "", err
+	}
+
+	limit := pageSize(size)
+	grants, err := s.repository.ListRoleGrants(ctx, roleId, after, limit+1)
+	if err != nil {
+		log.Printf("failed to list role grants: %v", err)
+		return nil, "", status.Errorf(codes.Internal, "failed to list users in role")
+	}
+
+	if len(grants) <= limit {
+		return grants, "", nil
+	}
+	grants = grants[:limit]
+	return grants, encodePageToken(grants[limit-1].UserID), nil
+}
+
+// DeleteRoleById deletes a role. Only admins may delete ADMIN. ADMIN and roles still granted to users or
+// inherited by other roles are only deleted when forced, in which case the
+// grants and inheritance links go too and the access tokens of everyone who
+// held the role, directly or through inheritance, are revoked.
+func (s *roleService) DeleteRoleById(ctx context.Context, id string, force bool) error {
+	role, err := s.GetRoleById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if role.Name == AdminRole {
+		if !force {
+			return status.Errorf(codes.FailedPrecondition, "the %s role can only be deleted when forced", AdminRole)
+		}
+		claims, err := s.authClient.Authenticate(ctx)
+		if err != nil {
+			return err
+		}
+		if !claims.HasRole(AdminRole) {
+			return status.Errorf(codes.PermissionDenied, "only admins may delete the %s role", AdminRole)
+		}
+	}
+
+	userIds, err := s.repository.DeleteRoleById(ctx, id, force)
+	if errors.Is(err, repository.ErrEntityNotFound) {
+		return status.Error(codes.NotFound, "role not found.")
+	} else if errors.Is(err, repository.ErrRoleInUse) {
+		return status.Error(codes.FailedPrecondition, "role is still granted to users or inherited by other roles")
+	} else if err != nil {
 		log.Printf("failed to delete role by id: %v", err)
 		return status.Errorf(codes.Internal, "failed to delete role by id")
 	}
+
+	for _, userId := range userIds {
+		if err := s.authClient.RevokeAccessTokens(ctx, userId); err != nil {
+			log.Printf("failed to revoke access tokens of user %s: %v", userId, err)
+		}
+	}
 	return nil
 }
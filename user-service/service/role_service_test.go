@@ -0,0 +1,141 @@
+package service
+
+import (
+	"authkit/authclient"
+	"context"
+	"testing"
+	"user-service/dto"
+	"user-service/models"
+	"user-service/repository"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeRoleRepository keeps roles in memory; parents maps a role id to the
+// ids of the roles it inherits. Methods the tests do not use panic through
+// the embedded nil interface.
+type fakeRoleRepository struct {
+	repository.RoleRepository
+
+	roles   map[string]models.Role
+	parents map[string][]string
+}
+
+func newFakeRoleRepository() *fakeRoleRepository {
+	return &fakeRoleRepository{
+		roles:   make(map[string]models.Role),
+		parents: make(map[string][]string),
+	}
+}
+
+func (r *fakeRoleRepository) add(name string, permissions []string, parents ...string) {
+	role := models.Role{ID: name, Name: name}
+	for _, permission := range permissions {
+		role.Permissions = append(role.Permissions, models.RolePermission{RoleID: name, Permission: permission})
+	}
+	r.roles[name] = role
+	r.parents[name] = parents
+}
+
+func (r *fakeRoleRepository) GetRoleByName(ctx context.Context, name string) (*models.Role, error) {
+	for _, role := range r.roles {
+		if role.Name == name {
+			return &role, nil
+		}
+	}
+	return nil, repository.ErrEntityNotFound
+}
+
+func (r *fakeRoleRepository) GetRoleById(ctx context.Context, id string) (*models.Role, error) {
+	role, ok := r.roles[id]
+	if !ok {
+		return nil, repository.ErrEntityNotFound
+	}
+	return &role, nil
+}
+
+func (r *fakeRoleRepository) GetEffectiveRoles(ctx context.Context, roleId string) ([]models.Role, error) {
+	seen := make(map[string]bool)
+	var roles []models.Role
+	frontier := []string{roleId}
+	for len(frontier) > 0 {
+		id := frontier[0]
+		frontier = frontier[1:]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		roles = append(roles, r.roles[id])
+		frontier = append(frontier, r.parents[id]...)
+	}
+	return roles, nil
+}
+
+func TestGetAssignableRole(t *testing.T) {
+	repo := newFakeRoleRepository()
+	repo.add(AdminRole, AdminPermissions)
+	repo.add("MEMBER", []string{"message.send"})
+	repo.add("MODERATOR", []string{"message.delete"}, "MEMBER")
+	repo.add("SUPERVISOR", nil, AdminRole)
+	s := &roleService{repository: repo}
+
+	admin := &authclient.Claims{Subject: "admin", Roles: []string{AdminRole}}
+	delegate := &authclient.Claims{
+		Subject:     "delegate",
+		Roles:       []string{"ASSIGNER"},
+		Permissions: []string{PermissionRoleAssign, "message.send"},
+	}
+
+	tests := []struct {
+		name   string
+		caller *authclient.Claims
+		role   string
+		want   codes.Code
+	}{
+		{"admin grants ADMIN", admin, AdminRole, codes.OK},
+		{"admin grants any role", admin, "MODERATOR", codes.OK},
+		{"delegate grants role within own permissions", delegate, "MEMBER", codes.OK},
+		{"delegate grants ADMIN", delegate, AdminRole, codes.PermissionDenied},
+		{"delegate grants role inheriting ADMIN", delegate, "SUPERVISOR", codes.PermissionDenied},
+		{"delegate grants role with permission they lack", delegate, "MODERATOR", codes.PermissionDenied},
+		{"unknown role", admin, "GHOST", codes.NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.GetAssignableRole(context.Background(), tt.caller, tt.role)
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("GetAssignableRole(%s) = %v, want %s", tt.role, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdminRoleNameIsReserved(t *testing.T) {
+	repo := newFakeRoleRepository()
+	repo.add("MEMBER", nil)
+	s := &roleService{repository: repo}
+	ctx := context.Background()
+
+	if _, err := s.CreateRole(ctx, &dto.CreateRoleDto{Name: AdminRole}, nil); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("CreateRole(%s) = %v, want InvalidArgument", AdminRole, err)
+	}
+	if _, err := s.CreateRoles(ctx, []dto.CreateRoleDto{{Name: "OTHER"}, {Name: AdminRole}}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("CreateRoles with %s = %v, want InvalidArgument", AdminRole, err)
+	}
+	if _, err := s.RenameRole(ctx, "MEMBER", AdminRole); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("RenameRole to %s = %v, want InvalidArgument", AdminRole, err)
+	}
+}
+
+func TestOnlyAdminsDeleteAdminRole(t *testing.T) {
+	repo := newFakeRoleRepository()
+	repo.add(AdminRole, AdminPermissions)
+	s := &roleService{repository: repo, authClient: &authclient.Client{}}
+
+	caller := &authclient.Claims{Subject: "delegate", Permissions: []string{PermissionRoleAssign}}
+	ctx := authclient.NewContext(context.Background(), caller)
+	if err := s.DeleteRoleById(ctx, AdminRole, true); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("forced DeleteRoleById(%s) by a non-admin = %v, want PermissionDenied", AdminRole, err)
+	}
+}
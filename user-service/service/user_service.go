@@ -4,12 +4,14 @@ import (
 	"context"
 	"errors"
 	"log"
+	"time"
 
-	"golang.org/x/crypto/bcrypt"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	"authkit/authclient"
 	"user-service/dto"
+	"user-service/hasher"
 	"user-service/models"
 	"user-service/repository"
 )
@@ -18,26 +20,36 @@ type UserService interface {
 	RegisterUser(ctx context.Context, data *dto.CreateUserDto) (string, error)
 	GetUserById(ctx context.Context, id string) (*models.User, error)
 	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
-	AssignRole(ctx context.Context, userId string, roleName string) error
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	ProvisionUser(ctx context.Context, data *dto.CreateUserDto) (string, error)
+	VerifyPassword(ctx context.Context, username string, password string) (*models.User, error)
+	AssignRole(ctx context.Context, userId string, roleName string, expiresAt *time.Time) error
+	RevokeRole(ctx context.Context, userId string, roleName string) error
+	SetPassword(ctx context.Context, userId string, password string) error
+	ChangePassword(ctx context.Context, currentPassword string, newPassword string) error
 	DeleteUserById(ctx context.Context, id string) error
 }
 
 type userService struct {
 	repository  repository.UserRepository
 	roleService RoleService
+	hasher      hasher.Hasher
+	authClient  *authclient.Client
 }
 
-func NewUserService(repository repository.UserRepository, roleService RoleService) UserService {
+func NewUserService(repository repository.UserRepository, roleService RoleService, hasher hasher.Hasher, authClient *authclient.Client) UserService {
 	return &userService{
 		repository:  repository,
 		roleService: roleService,
+		hasher:      hasher,
+		authClient:  authClient,
 	}
 }
 
 func (s *userService) RegisterUser(ctx context.Context, data *dto.CreateUserDto) (string, error) {
 	genericError := status.Error(codes.Internal, "failed to create user.")
 
-	hashedPassword, err := hashPassword(data.Password)
+	hashedPassword, err := s.hasher.Hash(ctx, data.Password)
 	if err != nil {
 		log.Printf("error hashing password: %v", err)
 		return "", genericError
@@ -46,10 +58,11 @@ func (s *userService) RegisterUser(ctx context.Context, data *dto.CreateUserDto)
 	userId, err := s.repository.CreateUser(ctx, &dto.CreateUserDto{
 		Name:     data.Name,
 		Username: data.Username,
+		Email:    data.Email,
 		Password: hashedPassword,
 	})
 	if errors.Is(err, repository.ErrDuplicateKey) {
-		return "", status.Error(codes.AlreadyExists, "username already exists.")
+		return "", status.Error(codes.AlreadyExists, "username or email already exists.")
 	} else if err != nil {
 		log.Printf("failed to create user: %v", err)
 		return "", genericError
@@ -58,6 +71,24 @@ func (s *userService) RegisterUser(ctx context.Context, data *dto.CreateUserDto)
 	return userId, nil
 }
 
+// ProvisionUser creates a password-less account. Its owner signs in through an
+// identity provider and may set a password later through a password reset.
+func (s *userService) ProvisionUser(ctx context.Context, data *dto.CreateUserDto) (string, error) {
+	userId, err := s.repository.CreateUser(ctx, &dto.CreateUserDto{
+		Name:     data.Name,
+		Username: data.Username,
+		Email:    data.Email,
+	})
+	if errors.Is(err, repository.ErrDuplicateKey) {
+		return "", status.Error(codes.AlreadyExists, "username or email already exists.")
+	} else if err != nil {
+		log.Printf("failed to provision user: %v", err)
+		return "", status.Error(codes.Internal, "failed to create user.")
+	}
+
+	return userId, nil
+}
+
 func (s *userService) GetUserById(ctx context.Context, id string) (*models.User, error) {
 	user, err := s.repository.GetUserById(ctx, id)
 	return handleFetchedUser(user, err)
@@ -68,13 +99,72 @@ func (s *userService) GetUserByUsername(ctx context.Context, username string) (*
 	return handleFetchedUser(user, err)
 }
 
-func (s *userService) AssignRole(ctx context.Context, userId string, roleName string) error {
-	role, err := s.roleService.GetRoleByName(ctx, roleName)
+func (s *userService) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	user, err := s.repository.GetUserByEmail(ctx, email)
+	return handleFetchedUser(user, err)
+}
+
+// VerifyPassword returns the user if password matches the stored hash. Unknown
+// users yield NotFound and wrong passwords Unauthenticated. Hashes made with
+// outdated settings are upgraded while the plaintext is at hand.
+func (s *userService) VerifyPassword(ctx context.Context, username string, password string) (*models.User, error) {
+	user, err := s.GetUserByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.comparePassword(ctx, user.Password, password); err != nil {
+		return nil, err
+	}
+
+	if s.hasher.NeedsRehash(user.Password) {
+		s.rehashPassword(ctx, user, password)
+	}
+	return user, nil
+}
+
+// rehashPassword stores a fresh hash of password. Failures are only logged:
+// the old hash keeps working and the upgrade is retried on the next login.
+func (s *userService) rehashPassword(ctx context.Context, user *models.User, password string) {
+	hashedPassword, err := s.hasher.Hash(ctx, password)
+	if err != nil {
+		log.Printf("error rehashing password of user %s: %v", user.ID, err)
+		return
+	}
+
+	if err := s.repository.UpdatePassword(ctx, user.ID, hashedPassword); err != nil {
+		log.Printf("failed to store rehashed password of user %s: %v", user.ID, err)
+		return
+	}
+	user.Password = hashedPassword
+}
+
+// AssignRole grants the role to the user on behalf of the caller, until
+// expiresAt when it is set. Assigning a role the user already holds replaces
+// the expiry of the grant. Callers who are not admins may only grant roles
+// within their own permissions.
+func (s *userService) AssignRole(ctx context.Context, userId string, roleName string, expiresAt *time.Time) error {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return status.Error(codes.InvalidArgument, "expiry must be in the future.")
+	}
+
+	claims, err := s.authClient.Authenticate(ctx)
 	if err != nil {
 		return err
 	}
 
-	err = s.repository.AssignRole(ctx, userId, role)
+	role, err := s.roleService.GetAssignableRole(ctx, claims, roleName)
+	if err != nil {
+		return err
+	}
+
+	grant := &dto.AssignRoleDto{
+		UserID:    userId,
+		RoleID:    role.ID,
+		GrantedBy: claims.Subject,
+		ExpiresAt: expiresAt,
+	}
+	err = s.repository.AssignRole(ctx, grant)
 	if errors.Is(err, repository.ErrEntityNotFound) {
 		return status.Error(codes.NotFound, "user not found.")
 	} else if err != nil {
@@ -85,8 +175,110 @@ func (s *userService) AssignRole(ctx context.Context, userId string, roleName st
 	return err
 }
 
+// RevokeRole removes a role granted to the user. Roles the user inherits
+// through another role are only lost by revoking that one. Callers may only
+// revoke the roles they could grant.
+func (s *userService) RevokeRole(ctx context.Context, userId string, roleName string) error {
+	claims, err := s.authClient.Authenticate(ctx)
+	if err != nil {
+		return err
+	}
+
+	role, err := s.roleService.GetAssignableRole(ctx, claims, roleName)
+	if err != nil {
+		return err
+	}
+
+	err = s.repository.RevokeRole(ctx, userId, role.ID)
+	if errors.Is(err, repository.ErrEntityNotFound) {
+		return status.Error(codes.NotFound, "user does not have this role.")
+	} else if err != nil {
+		log.Printf("failed to revoke role from user: %v", err)
+		return status.Error(codes.Internal, "failed to revoke role from user.")
+	}
+
+	s.revokeAccessTokens(ctx, userId)
+	return nil
+}
+
+func (s *userService) SetPassword(ctx context.Context, userId string, password string) error {
+	if password == "" {
+		return status.Error(codes.InvalidArgument, "password is required.")
+	}
+
+	hashedPassword, err := s.hasher.Hash(ctx, password)
+	if err != nil {
+		log.Printf("error hashing password: %v", err)
+		return status.Error(codes.Internal, "failed to set password.")
+	}
+
+	err = s.repository.UpdatePassword(ctx, userId, hashedPassword)
+	if errors.Is(err, repository.ErrEntityNotFound) {
+		return status.Error(codes.NotFound, "user not found.")
+	} else if err != nil {
+		log.Printf("failed to set password: %v", err)
+		return status.Error(codes.Internal, "failed to set password.")
+	}
+
+	return nil
+}
+
+// ChangePassword replaces the caller's password after checking the current
+// one, then signs the caller out of every other session. Wrong current
+// passwords count towards the same lockout as failed logins.
+func (s *userService) ChangePassword(ctx context.Context, currentPassword string, newPassword string) error {
+	if newPassword == "" {
+		return status.Error(codes.InvalidArgument, "new password is required.")
+	}
+
+	claims, err := s.authClient.Authenticate(ctx)
+	if err != nil {
+		return err
+	}
+	if !claims.Interactive() {
+		return status.Error(codes.PermissionDenied, "this action requires the user's own session")
+	}
+
+	user, err := s.GetUserById(ctx, claims.Subject)
+	if err != nil {
+		return err
+	}
+
+	if err := s.authClient.CheckPasswordGuard(ctx, user.Username); err != nil {
+		return err
+	}
+	if err := s.comparePassword(ctx, user.Password, currentPassword); status.Code(err) == codes.Unauthenticated {
+		if err := s.authClient.RecordPasswordFailure(ctx, user.Username); err != nil {
+			log.Printf("failed to record password failure of user %s: %v", user.ID, err)
+		}
+		return status.Error(codes.PermissionDenied, "current password is incorrect.")
+	} else if err != nil {
+		return err
+	}
+
+	if err := s.SetPassword(ctx, user.ID, newPassword); err != nil {
+		return err
+	}
+
+	if _, err := s.authClient.RevokeOtherSessions(ctx, user.ID); err != nil {
+		log.Printf("failed to revoke other sessions of user %s: %v", user.ID, err)
+	}
+	return nil
+}
+
+// DeleteUserById deletes a user. Admins and holders of user.delete may delete
+// anyone; users deleting their own account must do so from their own session,
+// not through an OAuth client, an API key or impersonation.
 func (s *userService) DeleteUserById(ctx context.Context, id string) error {
-	err := s.repository.DeleteUserById(ctx, id)
+	claims, err := s.authClient.Authenticate(ctx)
+	if err != nil {
+		return err
+	}
+	if !claims.HasRole(AdminRole) && !claims.HasPermission(PermissionUserDelete) && !claims.Interactive() {
+		return status.Error(codes.PermissionDenied, "this action requires the user's own session")
+	}
+
+	err = s.repository.DeleteUserById(ctx, id)
 
 	if errors.Is(err, repository.ErrEntityNotFound) {
 		return status.Error(codes.NotFound, "user not found.")
@@ -95,9 +287,19 @@ func (s *userService) DeleteUserById(ctx context.Context, id string) error {
 		return status.Error(codes.Internal, "failed to delete user.")
 	}
 
+	s.revokeAccessTokens(ctx, id)
 	return nil
 }
 
+// revokeAccessTokens makes auth-service reject tokens already issued to the
+// user, whose claims no longer match the account. Failing to do so is logged
+// rather than returned since the change itself has already been committed.
+func (s *userService) revokeAccessTokens(ctx context.Context, userId string) {
+	if err := s.authClient.RevokeAccessTokens(ctx, userId); err != nil {
+		log.Printf("failed to revoke access tokens of user %s: %v", userId, err)
+	}
+}
+
 func handleFetchedUser(user *models.User, err error) (*models.User, error) {
 	if errors.Is(err, repository.ErrEntityNotFound) {
 		return nil, status.Error(codes.NotFound, "User not found.")
@@ -108,7 +310,17 @@ func handleFetchedUser(user *models.User, err error) (*models.User, error) {
 	return user, nil
 }
 
-func hashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(hash), err
+func (s *userService) comparePassword(ctx context.Context, hashedPassword, password string) error {
+	if hashedPassword == "" {
+		return status.Error(codes.Unauthenticated, "wrong password.")
+	}
+
+	err := s.hasher.Verify(ctx, hashedPassword, password)
+	if errors.Is(err, hasher.ErrMismatchedPassword) {
+		return status.Error(codes.Unauthenticated, "wrong password.")
+	} else if err != nil {
+		log.Printf("error comparing password: %v", err)
+		return status.Error(codes.Internal, "failed to verify password.")
+	}
+	return nil
 }
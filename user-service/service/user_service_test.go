@@ -0,0 +1,47 @@
+package service
+
+import (
+	"authkit/authclient"
+	"context"
+	"testing"
+	"user-service/repository"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type fakeUserRepository struct {
+	repository.UserRepository
+
+	deleted []string
+}
+
+func (r *fakeUserRepository) DeleteUserById(ctx context.Context, id string) error {
+	r.deleted = append(r.deleted, id)
+	return nil
+}
+
+func TestDeleteOwnAccountRequiresUserSession(t *testing.T) {
+	tests := []struct {
+		name   string
+		caller authclient.Claims
+	}{
+		{"OAuth client token", authclient.Claims{Subject: "alice", ClientID: "client-1"}},
+		{"API key token", authclient.Claims{Subject: "alice", APIKeyID: "key-1"}},
+		{"impersonation token", authclient.Claims{Subject: "alice", ActorID: "admin"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeUserRepository{}
+			s := &userService{repository: repo, authClient: &authclient.Client{}}
+
+			ctx := authclient.NewContext(context.Background(), &tt.caller)
+			if err := s.DeleteUserById(ctx, "alice"); status.Code(err) != codes.PermissionDenied {
+				t.Errorf("DeleteUserById = %v, want PermissionDenied", err)
+			}
+			if len(repo.deleted) > 0 {
+				t.Error("account deleted")
+			}
+		})
+	}
+}